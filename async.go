@@ -0,0 +1,344 @@
+package ecslog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned by writers of this package after they have been closed.
+var ErrClosed = errors.New("ecslog: writer closed")
+
+// OverflowPolicy controls the behavior of [AsyncWriter] when its queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the caller until there is space in the queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the record being written.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest queued record to make space for the new one.
+	OverflowDropOldest
+	// OverflowDropBelowLevel drops the record being written if its level is below
+	// the one set by [WithAsyncDropLevel], otherwise the caller is blocked.
+	OverflowDropBelowLevel
+)
+
+type asyncOptions struct {
+	queueSize     int
+	batchSize     int
+	flushInterval time.Duration
+	policy        OverflowPolicy
+	dropLevel     slog.Level
+	hideTimestamp bool
+}
+
+// AsyncOption configures [AsyncWriter].
+type AsyncOption func(*asyncOptions)
+
+// WithAsyncQueueSize sets the maximum number of lines waiting to be written.
+// Default value is 1024.
+func WithAsyncQueueSize(size int) AsyncOption {
+	return func(o *asyncOptions) {
+		o.queueSize = max(size, 1)
+	}
+}
+
+// WithAsyncBatchSize sets the number of queued lines which triggers the flush
+// before the flush interval elapses. Default value is 128.
+func WithAsyncBatchSize(size int) AsyncOption {
+	return func(o *asyncOptions) {
+		o.batchSize = max(size, 1)
+	}
+}
+
+// WithAsyncFlushInterval sets the period of batch flushes. Default value is 200ms.
+func WithAsyncFlushInterval(interval time.Duration) AsyncOption {
+	return func(o *asyncOptions) {
+		o.flushInterval = interval
+	}
+}
+
+// WithAsyncOverflow sets the behavior when the queue is full. Default value is [OverflowBlock].
+func WithAsyncOverflow(policy OverflowPolicy) AsyncOption {
+	return func(o *asyncOptions) {
+		o.policy = policy
+	}
+}
+
+// WithAsyncDropLevel sets the level used by [OverflowDropBelowLevel].
+// Default value is slog.LevelWarn.
+func WithAsyncDropLevel(level slog.Level) AsyncOption {
+	return func(o *asyncOptions) {
+		o.dropLevel = level
+	}
+}
+
+// WithAsyncTimestamp option can be used to disable timestamp ("@timestamp" field)
+// in the summary records of dropped lines. It should match [WithTimestamp] of the handler.
+func WithAsyncTimestamp(showTimestamp bool) AsyncOption {
+	return func(o *asyncOptions) {
+		o.hideTimestamp = !showTimestamp
+	}
+}
+
+type asyncEntry struct {
+	level slog.Level
+	line  []byte
+}
+
+// AsyncWriter is an [io.Writer] which queues written lines and writes them in batches
+// to the underlying writer on its own goroutine. This way a slow destination does not stall
+// the callers of [Handler.Handle].
+//
+// The queue is bounded, and its behavior when full is controlled by [OverflowPolicy].
+// Whenever lines are dropped, a summary record is written with the next batch.
+//
+// AsyncWriter implements [LevelWriter]. Lines written with plain Write are considered to
+// be of slog.LevelInfo.
+type AsyncWriter struct {
+	writer  io.Writer
+	options asyncOptions
+
+	mu         sync.Mutex
+	notFull    *sync.Cond
+	queue      []asyncEntry
+	head       int
+	count      int
+	unreported uint64
+	closed     bool
+	err        error
+
+	dropped atomic.Uint64
+
+	wake   chan struct{}
+	flushC chan chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+
+	// batch is used only by the flushing goroutine
+	batch []byte
+}
+
+// NewAsyncWriter creates a new [AsyncWriter] writing to given writer and starts its
+// flushing goroutine. The writer should be closed by [AsyncWriter.Close].
+func NewAsyncWriter(writer io.Writer, options ...AsyncOption) *AsyncWriter {
+	opts := asyncOptions{
+		queueSize:     1024,
+		batchSize:     128,
+		flushInterval: 200 * time.Millisecond,
+		policy:        OverflowBlock,
+		dropLevel:     slog.LevelWarn,
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	w := &AsyncWriter{
+		writer:  writer,
+		options: opts,
+		queue:   make([]asyncEntry, opts.queueSize),
+		wake:    make(chan struct{}, 1),
+		flushC:  make(chan chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	w.notFull = sync.NewCond(&w.mu)
+
+	go w.run()
+	return w
+}
+
+// Write queues p as a line of slog.LevelInfo.
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(slog.LevelInfo, p)
+}
+
+// WriteLevel queues p as a line of given level. It blocks only with [OverflowBlock]
+// or [OverflowDropBelowLevel] policy, when the queue is full.
+func (w *AsyncWriter) WriteLevel(level slog.Level, p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for !w.closed && w.count == len(w.queue) {
+		w.signal()
+
+		switch {
+		case w.options.policy == OverflowDropNewest,
+			w.options.policy == OverflowDropBelowLevel && level < w.options.dropLevel:
+
+			w.drop()
+			return len(p), nil
+		case w.options.policy == OverflowDropOldest:
+			w.head = (w.head + 1) % len(w.queue)
+			w.count--
+			w.drop()
+		default:
+			w.notFull.Wait()
+		}
+	}
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	entry := &w.queue[(w.head+w.count)%len(w.queue)]
+	entry.level = level
+	entry.line = append(entry.line[:0], p...)
+	w.count++
+
+	if w.count >= w.options.batchSize {
+		w.signal()
+	}
+	return len(p), nil
+}
+
+// Dropped returns the total number of lines dropped due to the full queue.
+func (w *AsyncWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Flush writes all queued lines to the underlying writer. It returns the first error
+// returned by the underlying writer since the last Flush, or the context error.
+func (w *AsyncWriter) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case w.flushC <- done:
+	case <-w.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return w.takeErr()
+}
+
+// Close flushes all queued lines and stops the flushing goroutine. Writes blocked
+// on the full queue and all further writes fail with [ErrClosed].
+//
+// If the context ends before the queue is flushed, its error is returned
+// and the remaining lines are written in the background.
+func (w *AsyncWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	w.closed = true
+	w.notFull.Broadcast()
+	w.mu.Unlock()
+
+	close(w.stop)
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return w.takeErr()
+}
+
+// drop must be called with w.mu held
+func (w *AsyncWriter) drop() {
+	w.unreported++
+	w.dropped.Add(1)
+}
+
+func (w *AsyncWriter) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *AsyncWriter) takeErr() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.err
+	w.err = nil
+	return err
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+
+	var tick <-chan time.Time
+	if w.options.flushInterval > 0 {
+		ticker := time.NewTicker(w.options.flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-w.wake:
+		case <-tick:
+		case flushed := <-w.flushC:
+			w.flush()
+			close(flushed)
+			continue
+		case <-w.stop:
+			w.flush()
+			return
+		}
+		w.flush()
+	}
+}
+
+func (w *AsyncWriter) flush() {
+	w.mu.Lock()
+	batch := w.batch[:0]
+	for ; w.count > 0; w.count-- {
+		entry := &w.queue[w.head]
+		batch = append(batch, entry.line...)
+		if cap(entry.line) > handleCtxMaxBufferSize {
+			entry.line = nil
+		}
+		w.head = (w.head + 1) % len(w.queue)
+	}
+	dropped := w.unreported
+	w.unreported = 0
+	w.notFull.Broadcast()
+	w.mu.Unlock()
+
+	if dropped > 0 {
+		var t0 time.Time
+		if !w.options.hideTimestamp {
+			t0 = time.Now()
+		}
+		batch = appendInternalRecord(batch, t0, slog.LevelWarn,
+			fmt.Sprintf("dropped %d log records due to full queue", dropped),
+			slog.String("event.kind", "metric"),
+			slog.String("event.action", "log-records-dropped"),
+			// ECS labels are keywords, so the count is a string
+			slog.String("labels.dropped_records", strconv.FormatUint(dropped, 10)),
+		)
+	}
+
+	if len(batch) > 0 {
+		if _, err := w.writer.Write(batch); err != nil {
+			w.mu.Lock()
+			if w.err == nil {
+				w.err = err
+			}
+			w.mu.Unlock()
+		}
+	}
+
+	if cap(batch) > handleCtxMaxBufferSize*16 {
+		batch = nil
+	}
+	w.batch = batch
+}
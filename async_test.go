@@ -0,0 +1,224 @@
+package ecslog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+type syncBuffer struct {
+	mu     sync.Mutex
+	buff   bytes.Buffer
+	writes int
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writes++
+	return b.buff.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buff.String()
+}
+
+func (b *syncBuffer) lines() []string {
+	return strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+}
+
+func TestAsyncWriter_Handler(t *testing.T) {
+	buff := &syncBuffer{}
+	w := NewAsyncWriter(buff)
+	ecs := slog.New(NewHandler(w, WithTimestamp(false)))
+
+	ecs.Info("first", slog.String("event.action", "test"))
+	ecs.Warn("second")
+
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("close failed: %s", err)
+	}
+
+	var expectedOutput = []val{
+		{"message": "first", "log": val{"level": "INFO"}, "event": val{"action": "test"}},
+		{"message": "second", "log": val{"level": "WARN"}},
+	}
+	output := unmarshalLogs(t, strings.NewReader(buff.String()))
+	if !reflect.DeepEqual(output, expectedOutput) {
+		t.Errorf("mismatched log data\nEXP: %#v\nGOT: %#v", expectedOutput, output)
+	}
+
+	if _, err := w.Write([]byte("late\n")); !errors.Is(err, ErrClosed) {
+		t.Errorf("write after close should fail, got %v", err)
+	}
+}
+
+var asyncOverflowTestData = []struct {
+	name     string
+	policy   OverflowPolicy
+	expected []string
+}{
+	{
+		name:     "DropNewest",
+		policy:   OverflowDropNewest,
+		expected: []string{"a", "b"},
+	},
+	{
+		name:     "DropOldest",
+		policy:   OverflowDropOldest,
+		expected: []string{"d", "e"},
+	},
+	{
+		name:     "DropBelowLevel",
+		policy:   OverflowDropBelowLevel,
+		expected: []string{"a", "b"},
+	},
+}
+
+// gateWriter blocks writes until the gate is closed, entered receives on every write
+type gateWriter struct {
+	syncBuffer
+	entered chan struct{}
+	gate    chan struct{}
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	w.entered <- struct{}{}
+	<-w.gate
+	return w.syncBuffer.Write(p)
+}
+
+func TestAsyncWriter_Overflow(t *testing.T) {
+	for _, data := range asyncOverflowTestData {
+		t.Run(data.name, func(t *testing.T) {
+			buff := &gateWriter{entered: make(chan struct{}, 16), gate: make(chan struct{})}
+			w := NewAsyncWriter(buff,
+				WithAsyncQueueSize(2),
+				WithAsyncBatchSize(1),
+				WithAsyncFlushInterval(0),
+				WithAsyncOverflow(data.policy),
+				WithAsyncTimestamp(false),
+			)
+
+			// the flushing goroutine is blocked in the underlying writer,
+			// so it cannot drain the queue while it overflows
+			if _, err := w.Write([]byte("start\n")); err != nil {
+				t.Fatalf("write failed: %s", err)
+			}
+			<-buff.entered
+
+			for _, line := range []string{"a", "b", "c", "d", "e"} {
+				if _, err := w.Write([]byte(line + "\n")); err != nil {
+					t.Fatalf("write failed: %s", err)
+				}
+			}
+			close(buff.gate)
+			if err := w.Close(context.Background()); err != nil {
+				t.Fatalf("close failed: %s", err)
+			}
+
+			if w.Dropped() != 3 {
+				t.Errorf("expected 3 dropped lines, got %d", w.Dropped())
+			}
+
+			lines := buff.lines()
+			expected := append([]string{"start"}, data.expected...)
+			if !reflect.DeepEqual(lines[:len(lines)-1], expected) {
+				t.Errorf("unexpected lines: %#v", lines)
+			}
+
+			summary := unmarshalLogs(t, strings.NewReader(lines[len(lines)-1]))
+			if summary[0]["labels"].(val)["dropped_records"] != "3" {
+				t.Errorf("unexpected summary: %s", lines[len(lines)-1])
+			}
+			if _, ok := summary[0]["@timestamp"]; ok {
+				t.Errorf("summary should not have timestamp: %s", lines[len(lines)-1])
+			}
+		})
+	}
+}
+
+func TestAsyncWriter_Block(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		buff := &syncBuffer{}
+		w := NewAsyncWriter(buff,
+			WithAsyncQueueSize(1),
+			WithAsyncFlushInterval(0),
+			WithAsyncOverflow(OverflowDropBelowLevel),
+		)
+
+		_, _ = w.WriteLevel(slog.LevelInfo, []byte("a\n"))
+		_, _ = w.WriteLevel(slog.LevelInfo, []byte("b\n"))
+
+		written := make(chan struct{})
+		go func() {
+			_, _ = w.WriteLevel(slog.LevelError, []byte("c\n"))
+			close(written)
+		}()
+		synctest.Wait()
+
+		// the queue was full, so the first flush was already triggered
+		<-written
+		if err := w.Close(context.Background()); err != nil {
+			t.Fatalf("close failed: %s", err)
+		}
+
+		if w.Dropped() != 1 {
+			t.Errorf("expected 1 dropped line, got %d", w.Dropped())
+		}
+		output := buff.String()
+		if !strings.HasPrefix(output, "a\n") || !strings.HasSuffix(output, "c\n") {
+			t.Errorf("unexpected output: %s", output)
+		}
+	})
+}
+
+func TestAsyncWriter_Interval(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		buff := &syncBuffer{}
+		w := NewAsyncWriter(buff, WithAsyncFlushInterval(time.Second))
+		defer func() { _ = w.Close(context.Background()) }()
+
+		_, _ = w.Write([]byte("a\n"))
+		_, _ = w.Write([]byte("b\n"))
+
+		synctest.Wait()
+		if buff.String() != "" {
+			t.Fatalf("lines written before flush interval: %s", buff.String())
+		}
+
+		time.Sleep(time.Second)
+		synctest.Wait()
+		if buff.String() != "a\nb\n" || buff.writes != 1 {
+			t.Errorf("expected single batch write, got %d writes: %s", buff.writes, buff.String())
+		}
+	})
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("failed")
+}
+
+func TestAsyncWriter_FlushError(t *testing.T) {
+	w := NewAsyncWriter(failingWriter{})
+	defer func() { _ = w.Close(context.Background()) }()
+
+	_, _ = w.Write([]byte("a\n"))
+	if err := w.Flush(context.Background()); err == nil {
+		t.Error("flush should return the write error")
+	}
+	if err := w.Flush(context.Background()); err != nil {
+		t.Errorf("error should be reported only once, got %s", err)
+	}
+}
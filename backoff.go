@@ -0,0 +1,44 @@
+package ecslog
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// backoff is the exponential backoff between retries of the network writers
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+	current time.Duration
+}
+
+func newBackoff(initial, max time.Duration) backoff {
+	return backoff{initial: initial, max: max, current: initial}
+}
+
+// next returns the delay before the next attempt and doubles the following one.
+// Equal jitter draws the delay from the upper half of the current interval, so the retries
+// of multiple writers are spread apart while the delay still grows with each attempt.
+func (b *backoff) next() time.Duration {
+	delay := b.current/2 + rand.N(b.current/2+1)
+	b.current = min(b.current*2, b.max)
+	return delay
+}
+
+// reset starts the backoff again from the initial delay after a success
+func (b *backoff) reset() {
+	b.current = b.initial
+}
+
+// wait sleeps for the next delay and reports false when done is closed in the meantime
+func (b *backoff) wait(done <-chan struct{}) bool {
+	timer := time.NewTimer(b.next())
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
@@ -0,0 +1,271 @@
+package ecslog
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/maphash"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type collapseOptions struct {
+	interval time.Duration
+	annotate bool
+}
+
+// CollapseOption configures [CollapsingHandler].
+type CollapseOption func(*collapseOptions)
+
+// WithCollapseInterval sets the maximum time the repeated records are held back.
+// Default value is 1s.
+func WithCollapseInterval(interval time.Duration) CollapseOption {
+	return func(o *collapseOptions) {
+		o.interval = interval
+	}
+}
+
+// WithCollapseAnnotation option can be used to append " (repeated N times)" to the message
+// of the record summarizing the repeated records.
+func WithCollapseAnnotation(annotate bool) CollapseOption {
+	return func(o *collapseOptions) {
+		o.annotate = annotate
+	}
+}
+
+// collapser holds the state shared by CollapsingHandler and its derived handlers
+type collapser struct {
+	options collapseOptions
+	seed    maphash.Seed
+
+	mu          sync.Mutex
+	fingerprint uint64
+	// writeMu is taken under mu before the held repeats are taken and held until they are written
+	// with the record which broke them, so the records keep their order, while the repeats
+	// are counted and the records of other goroutines fingerprinted under mu only
+	writeMu sync.Mutex
+	scratch     []byte
+
+	// repeats of the last record held back
+	count   int
+	first   time.Time
+	last    time.Time
+	held    slog.Record
+	heldBy  *Handler
+	heldCtx context.Context
+	extra   []slog.Attr
+	timer   *time.Timer
+}
+
+// CollapsingHandler is [Handler] wrapper which collapses consecutive records with identical
+// level, message and attributes. The first record is logged immediately, its repeats are
+// held back and logged as a single record with "event.count" set to the number of repeats and
+// "event.start" and "event.end" set to the time of the first and the last repeat, similar
+// to syslog's "last message repeated N times".
+//
+// The repeats are logged when a different record arrives or when the interval elapses.
+// The fingerprint of the record is computed from the same sorted attributes as used by [Handler],
+// so the timestamp is not part of it. Therefore the handler must wrap [Handler] directly,
+// other wrappers of this package, such as [RateLimitHandler], may be placed above it.
+type CollapsingHandler struct {
+	next      *Handler
+	collapser *collapser
+}
+
+// NewCollapsingHandler creates a new [CollapsingHandler] passing the records to next.
+func NewCollapsingHandler(next *Handler, options ...CollapseOption) *CollapsingHandler {
+	c := &collapser{
+		options: collapseOptions{
+			interval: time.Second,
+		},
+		seed: maphash.MakeSeed(),
+	}
+	for _, option := range options {
+		option(&c.options)
+	}
+
+	return &CollapsingHandler{
+		next:      next,
+		collapser: c,
+	}
+}
+
+// Flush logs the repeats held back immediately.
+func (h *CollapsingHandler) Flush(_ context.Context) error {
+	c := h.collapser
+	c.mu.Lock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	repeats := c.take()
+	c.mu.Unlock()
+	return repeats.log()
+}
+
+// Enabled reports whether the next handler handles records at given level.
+func (h *CollapsingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle passes the record to the next handler, unless it repeats the last record.
+func (h *CollapsingHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handleWithAttrs(ctx, record, nil)
+}
+
+func (h *CollapsingHandler) handleWithAttrs(ctx context.Context, record slog.Record, extra []slog.Attr) error {
+	handleCtx := h.next.getHandleCtx()
+	attrs := h.next.appendAttrs(handleCtx, ctx, record, extra)
+	output := handleCtx.outputBuffer[:0]
+
+	c := h.collapser
+	c.mu.Lock()
+	fingerprint := c.fingerprintOf(record, attrs)
+	if fingerprint == c.fingerprint {
+		t0 := record.Time
+		if t0.IsZero() {
+			t0 = time.Now()
+		}
+		if c.count == 0 {
+			c.first = t0
+			c.held = record.Clone()
+			c.heldBy = h.next
+			c.heldCtx = context.WithoutCancel(ctx)
+			c.extra = slices.Clone(extra)
+			c.timer = time.AfterFunc(c.options.interval, c.flushTimer)
+		}
+		c.count++
+		c.last = t0
+		c.mu.Unlock()
+
+		h.next.putHandleCtx(handleCtx, output, attrs)
+		return nil
+	}
+	c.writeMu.Lock()
+	repeats := c.take()
+	c.fingerprint = fingerprint
+	c.mu.Unlock()
+
+	// the records are written outside of the lock, so slow writers do not block counting of the repeats
+	err := repeats.log()
+	output = h.next.appendRecord(output, record, attrs)
+	if writeErr := h.next.write(record.Level, output); writeErr != nil {
+		err = writeErr
+	}
+	c.writeMu.Unlock()
+
+	h.next.putHandleCtx(handleCtx, output, attrs)
+	return err
+}
+
+func (c *collapser) flushTimer() {
+	c.mu.Lock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	repeats := c.take()
+	c.mu.Unlock()
+	_ = repeats.log()
+}
+
+// heldRepeats is the record summarizing the repeats, which is logged outside of collapser's lock
+type heldRepeats struct {
+	handler *Handler
+	ctx     context.Context
+	record  slog.Record
+	extra   []slog.Attr
+}
+
+// log logs the record with the context of the first repeat
+func (r heldRepeats) log() error {
+	if r.handler == nil {
+		return nil
+	}
+	return r.handler.handleWithAttrs(r.ctx, r.record, r.extra)
+}
+
+// take returns the summary of the held repeats and resets them,
+// it must be called with c.mu held
+func (c *collapser) take() heldRepeats {
+	if c.count == 0 {
+		return heldRepeats{}
+	}
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+
+	record := c.held
+	record.Time = c.last
+	if c.options.annotate {
+		record.Message += " (repeated " + strconv.Itoa(c.count) + " times)"
+	}
+	repeats := heldRepeats{
+		handler: c.heldBy,
+		ctx:     c.heldCtx,
+		record:  record,
+		extra: append(c.extra,
+			slog.Int("event.count", c.count),
+			slog.Time("event.start", c.first),
+			slog.Time("event.end", c.last),
+		),
+	}
+
+	// the following repeats of the same record are collapsed again
+	c.count = 0
+	c.held = slog.Record{}
+	c.heldBy = nil
+	c.heldCtx = nil
+	c.extra = nil
+	return repeats
+}
+
+// fingerprintOf hashes level, message and sorted attributes of the record,
+// it must be called with c.mu held
+func (c *collapser) fingerprintOf(record slog.Record, sortedAttrs []slog.Attr) uint64 {
+	var hash maphash.Hash
+	hash.SetSeed(c.seed)
+
+	_, _ = hash.WriteString(record.Message)
+	for _, attr := range sortedAttrs {
+		_ = hash.WriteByte(0)
+		_, _ = hash.WriteString(attr.Key)
+		_ = hash.WriteByte(0)
+
+		// attributes from WithAttrs are hashed as the attributes of the record
+		value := unwrapPreformatted(attr.Value)
+		switch value.Kind() {
+		case slog.KindString:
+			_, _ = hash.WriteString(value.String())
+		case slog.KindInt64:
+			c.scratch = binary.LittleEndian.AppendUint64(c.scratch[:0], uint64(value.Int64()))
+			_, _ = hash.Write(c.scratch)
+		case slog.KindUint64:
+			c.scratch = binary.LittleEndian.AppendUint64(c.scratch[:0], value.Uint64())
+			_, _ = hash.Write(c.scratch)
+		case slog.KindFloat64:
+			c.scratch = binary.LittleEndian.AppendUint64(c.scratch[:0], math.Float64bits(value.Float64()))
+			_, _ = hash.Write(c.scratch)
+		default:
+			c.scratch = appendJsonValue(c.scratch[:0], value)
+			_, _ = hash.Write(c.scratch)
+		}
+	}
+	return hash.Sum64()
+}
+
+// WithAttrs creates new [CollapsingHandler] sharing the state with h.
+func (h *CollapsingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &CollapsingHandler{
+		next:      h.next.WithAttrs(attrs).(*Handler),
+		collapser: h.collapser,
+	}
+}
+
+// WithGroup creates new [CollapsingHandler] sharing the state with h.
+func (h *CollapsingHandler) WithGroup(name string) slog.Handler {
+	return &CollapsingHandler{
+		next:      h.next.WithGroup(name).(*Handler),
+		collapser: h.collapser,
+	}
+}
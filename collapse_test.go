@@ -0,0 +1,104 @@
+package ecslog
+
+import (
+	"bytes"
+	"log/slog"
+	"reflect"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func TestCollapsingHandler(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		buff := &syncBuffer{}
+		logger := slog.New(NewCollapsingHandler(NewHandler(buff, WithTimestamp(false)),
+			WithCollapseInterval(time.Minute),
+			WithCollapseAnnotation(true),
+		))
+		start := time.Now()
+
+		for range 4 {
+			logger.Warn("reconnecting", "server.address", "db")
+			time.Sleep(time.Second)
+		}
+		// different attributes break the burst
+		logger.Warn("reconnecting", "server.address", "cache")
+		logger.With("server.address", "cache").Warn("reconnecting")
+
+		// the held repeats are logged after the interval
+		time.Sleep(time.Minute)
+		synctest.Wait()
+
+		expected := []map[string]interface{}{
+			{"log": val{"level": "WARN"}, "message": "reconnecting", "server": val{"address": "db"}},
+			{
+				"log":     val{"level": "WARN"},
+				"message": "reconnecting (repeated 3 times)",
+				"server":  val{"address": "db"},
+				"event": val{
+					"count": float64(3),
+					"start": start.Add(time.Second).Format(time.RFC3339Nano),
+					"end":   start.Add(3 * time.Second).Format(time.RFC3339Nano),
+				},
+			},
+			{"log": val{"level": "WARN"}, "message": "reconnecting", "server": val{"address": "cache"}},
+			{
+				"log":     val{"level": "WARN"},
+				"message": "reconnecting (repeated 1 times)",
+				"server":  val{"address": "cache"},
+				"event": val{
+					"count": float64(1),
+					"start": start.Add(4 * time.Second).Format(time.RFC3339Nano),
+					"end":   start.Add(4 * time.Second).Format(time.RFC3339Nano),
+				},
+			},
+		}
+		if output := unmarshalLogs(t, &buff.buff); !reflect.DeepEqual(output, expected) {
+			t.Errorf("mismatched output\nEXP: %v\nGOT: %v", expected, output)
+		}
+	})
+}
+
+// summaryBlockingWriter blocks writes of the summaries of repeats until release is closed
+type summaryBlockingWriter struct {
+	release chan struct{}
+	buff    syncBuffer
+}
+
+func (w *summaryBlockingWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("repeated")) {
+		<-w.release
+	}
+	return w.buff.Write(p)
+}
+
+func TestCollapsingHandler_Order(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		writer := &summaryBlockingWriter{release: make(chan struct{})}
+		logger := slog.New(NewCollapsingHandler(NewHandler(writer, WithTimestamp(false)),
+			WithCollapseInterval(time.Minute),
+			WithCollapseAnnotation(true),
+		))
+
+		logger.Info("first")
+		logger.Info("first")
+		go logger.Info("second")
+		synctest.Wait()
+
+		// the record logged while the summary is being written does not overtake it
+		go logger.Info("third")
+		synctest.Wait()
+		close(writer.release)
+		synctest.Wait()
+
+		var messages []any
+		for _, line := range unmarshalLogs(t, &writer.buff.buff) {
+			messages = append(messages, line["message"])
+		}
+		expected := []any{"first", "first (repeated 1 times)", "second", "third"}
+		if !reflect.DeepEqual(messages, expected) {
+			t.Errorf("mismatched messages\nEXP: %v\nGOT: %v", expected, messages)
+		}
+	})
+}
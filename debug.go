@@ -0,0 +1,99 @@
+package ecslog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// debugSessionKey is the context key of the debug session
+type debugSessionKey struct{}
+
+// debugSessionMaxLen is the maximum length of the session ID accepted by DebugMiddleware
+const debugSessionMaxLen = 64
+
+// WithDebug returns a copy of ctx with a new debug session. [Handler] created with
+// [WithDebugSessions] option logs all records with the returned context regardless of the level
+// and tags them with "labels.debug_session" containing randomly generated session ID.
+func WithDebug(ctx context.Context) context.Context {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	return WithDebugSession(ctx, hex.EncodeToString(id[:]))
+}
+
+// WithDebugSession returns a copy of ctx with debug session of given ID, see [WithDebug].
+func WithDebugSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, debugSessionKey{}, id)
+}
+
+// DebugSession returns ID of the debug session of ctx.
+func DebugSession(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(debugSessionKey{}).(string)
+	return id, ok
+}
+
+type debugMiddlewareOptions struct {
+	header string
+}
+
+// DebugMiddlewareOption configures [DebugMiddleware].
+type DebugMiddlewareOption func(*debugMiddlewareOptions)
+
+// WithDebugHeader sets the name of the request header, which starts the debug session.
+// The value of the header is used as the session ID. Default value is "X-Debug-Session".
+func WithDebugHeader(header string) DebugMiddlewareOption {
+	return func(o *debugMiddlewareOptions) {
+		o.header = header
+	}
+}
+
+// DebugMiddleware starts debug session (see [WithDebug]) for the requests with the debug header,
+// so all records logged with the request context are logged.
+//
+// Since the header allows the client to increase the amount of logs, the session is started only
+// when authorize returns true for the request. When authorize is nil, no session is started.
+// The session ID from the header must consist of at most 64 letters, digits, '.', '_' or '-',
+// otherwise the header is ignored.
+func DebugMiddleware(next http.Handler, authorize func(r *http.Request) bool, options ...DebugMiddlewareOption) http.Handler {
+	opts := debugMiddlewareOptions{
+		header: "X-Debug-Session",
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(opts.header)
+		if isValidDebugSession(id) && authorize != nil && authorize(r) {
+			r = r.WithContext(WithDebugSession(r.Context(), id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isValidDebugSession reports whether the session ID from the request may be logged
+func isValidDebugSession(id string) bool {
+	if id == "" || len(id) > debugSessionMaxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// appendDebugSession adds "labels.debug_session" for records logged in debug session
+func appendDebugSession(attrs []slog.Attr, ctx context.Context) []slog.Attr {
+	if id, ok := DebugSession(ctx); ok {
+		attrs = append(attrs, slog.String("labels.debug_session", id))
+	}
+	return attrs
+}
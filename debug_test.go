@@ -0,0 +1,94 @@
+package ecslog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithDebug(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := slog.New(NewHandler(buff, WithTimestamp(false), WithDebugSessions(true)))
+
+	ctx := WithDebug(context.Background())
+	id, ok := DebugSession(ctx)
+	if !ok || len(id) != 16 {
+		t.Fatalf("unexpected debug session %q", id)
+	}
+
+	logger.Debug("not logged")
+	logger.DebugContext(ctx, "logged")
+	logger.InfoContext(context.Background(), "info")
+
+	logs := unmarshalLogs(t, buff)
+	if len(logs) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(logs))
+	}
+	labels, _ := logs[0]["labels"].(map[string]any)
+	if logs[0]["message"] != "logged" || labels["debug_session"] != id {
+		t.Errorf("unexpected debug record: %v", logs[0])
+	}
+	if _, ok := logs[1]["labels"]; ok {
+		t.Errorf("unexpected labels outside of debug session: %v", logs[1])
+	}
+}
+
+var debugMiddlewareTestData = []struct {
+	name      string
+	header    string
+	authorize func(r *http.Request) bool
+	session   string
+	debug     bool
+}{
+	{"NoHeader", "", authorizeAll, "", false},
+	{"NoAuthorize", "abc", nil, "", false},
+	{"Authorized", "abc-1.2_3", authorizeAll, "abc-1.2_3", true},
+	{"Unauthorized", "abc", func(r *http.Request) bool { return false }, "", false},
+	{"InvalidCharacters", "abc\ndef", authorizeAll, "", false},
+	{"TooLong", strings.Repeat("a", 65), authorizeAll, "", false},
+}
+
+func authorizeAll(*http.Request) bool { return true }
+
+func TestDebugMiddleware(t *testing.T) {
+	for _, data := range debugMiddlewareTestData {
+		t.Run(data.name, func(t *testing.T) {
+			var session string
+			var debug bool
+			handler := DebugMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				session, debug = DebugSession(r.Context())
+			}), data.authorize)
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if data.header != "" {
+				request.Header["X-Debug-Session"] = []string{data.header}
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			if session != data.session || debug != data.debug {
+				t.Errorf("expected session %q (%v), got %q (%v)", data.session, data.debug, session, debug)
+			}
+		})
+	}
+}
+
+func TestWithDebug_Disabled(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := slog.New(NewHandler(buff, WithTimestamp(false)))
+
+	ctx := WithDebug(context.Background())
+	logger.DebugContext(ctx, "not logged")
+	logger.InfoContext(ctx, "info")
+
+	logs := unmarshalLogs(t, buff)
+	if len(logs) != 1 || logs[0]["message"] != "info" {
+		t.Fatalf("unexpected records: %v", logs)
+	}
+	if _, ok := logs[0]["labels"]; ok {
+		t.Errorf("unexpected labels without debug sessions: %v", logs[0])
+	}
+}
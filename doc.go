@@ -21,6 +21,15 @@ will produce deduplicated JSON record, which contains "last" value.
 	datasetLog.Info(slog.String("event.action", "test"))
 	// {"event": {"action": "test"}, ...}
 
+Structs with fields tagged with `ecs:"<dotted key>"` can be logged using [Fields] (or slog.Any
+with empty key), which expands the tagged fields to separate attributes merged with the others.
+
+	type User struct {
+		Name string `ecs:"user.name"`
+	}
+	log.With(slog.String("user.domain", "example.com")).Info("login", ecslog.Fields(User{Name: "john"}))
+	// {"user": {"domain": "example.com", "name": "john"}, ...}
+
 # Limitations
 
 The approach with dot notation, combined with aim to be as fast as [slog.JSONHandler] leads to some
@@ -30,8 +39,9 @@ this attribute kind and will handle it as expected most of the time, sometimes i
   - Specifying both `slog.Group("event", ...)` and `slog.String("event.log", ...)` will always
     ignore the attributes nested with the dot notation, outputing only the group.
   - Multiple [slog.Group] with same keys are not merged, the last[1] one is used.
-  - Attribute [slog.Group] with empty key is not inlined. This rule is outlines by [slog.Handler],
-    but due to how groups are implemented, it is not possible without some sacrifices on the way.
+  - Attribute [slog.Group] with empty key is inlined only when it is not nested in another group.
+    This rule is outlined by [slog.Handler], but due to how groups are implemented, it is not possible
+    for nested groups without some sacrifices on the way.
 
 [ECS]: https://github.com/elastic/ecs
 */
@@ -0,0 +1,444 @@
+package ecslog
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type elasticsearchOptions struct {
+	client         *http.Client
+	apiKey         string
+	username       string
+	password       string
+	batchSize      int
+	flushInterval  time.Duration
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	deadLetterPath string
+	dataset        string
+	namespace      string
+}
+
+// ElasticsearchOption configures [ElasticsearchWriter].
+type ElasticsearchOption func(*elasticsearchOptions)
+
+// WithElasticsearchClient sets the HTTP client used for the requests. Default value is [http.DefaultClient].
+func WithElasticsearchClient(client *http.Client) ElasticsearchOption {
+	return func(o *elasticsearchOptions) {
+		o.client = client
+	}
+}
+
+// WithElasticsearchAPIKey sets the API key (base64 encoded "id:key") used for authentication.
+func WithElasticsearchAPIKey(apiKey string) ElasticsearchOption {
+	return func(o *elasticsearchOptions) {
+		o.apiKey = apiKey
+	}
+}
+
+// WithElasticsearchBasicAuth sets the credentials used for basic authentication.
+func WithElasticsearchBasicAuth(username, password string) ElasticsearchOption {
+	return func(o *elasticsearchOptions) {
+		o.username = username
+		o.password = password
+	}
+}
+
+// WithElasticsearchBatchSize sets the size in bytes of buffered documents which triggers
+// the bulk request. Default value is 1MiB.
+func WithElasticsearchBatchSize(size int) ElasticsearchOption {
+	return func(o *elasticsearchOptions) {
+		o.batchSize = size
+	}
+}
+
+// WithElasticsearchFlushInterval sets the maximum time documents are buffered. Default value is 1s.
+func WithElasticsearchFlushInterval(interval time.Duration) ElasticsearchOption {
+	return func(o *elasticsearchOptions) {
+		o.flushInterval = interval
+	}
+}
+
+// WithElasticsearchRetries sets the maximum number of retries of documents rejected with
+// status 429 or 5xx and the bounds of the exponential backoff between them.
+// Default values are 3 retries with backoff from 100ms to 10s.
+func WithElasticsearchRetries(maxRetries int, initialBackoff, maxBackoff time.Duration) ElasticsearchOption {
+	return func(o *elasticsearchOptions) {
+		o.maxRetries = maxRetries
+		o.initialBackoff = initialBackoff
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// WithElasticsearchDeadLetterFile sets the path of the file, where the documents which could not be
+// indexed are appended as they were written. Without the file, such documents are dropped.
+func WithElasticsearchDeadLetterFile(path string) ElasticsearchOption {
+	return func(o *elasticsearchOptions) {
+		o.deadLetterPath = path
+	}
+}
+
+// WithElasticsearchDataStream sets the dataset and namespace used for the documents which do not
+// specify them. Default values are "generic" and "default".
+func WithElasticsearchDataStream(dataset, namespace string) ElasticsearchOption {
+	return func(o *elasticsearchOptions) {
+		o.dataset = dataset
+		o.namespace = namespace
+	}
+}
+
+type elasticsearchDoc struct {
+	index string
+	line  []byte
+}
+
+// ElasticsearchWriter is an [io.Writer] which ships lines produced by [Handler] to Elasticsearch
+// using the bulk API.
+//
+// Each document is created in a data stream "<type>-<dataset>-<namespace>". The values
+// are taken from "data_stream.type", "data_stream.dataset" and "data_stream.namespace" fields
+// of the record, the dataset falls back to "event.dataset", and the rest to the options.
+//
+// Documents are buffered and sent by a background goroutine when the flush interval elapses.
+// The Write which fills the buffer up to the batch size sends the bulk request itself, so it blocks
+// until the documents are indexed or dead-lettered, including the retries and the backoff between
+// them; for non-blocking behavior wrap the writer with [AsyncWriter].
+//
+// Documents rejected with status 429 or 5xx are retried with exponential backoff,
+// the documents which could not be indexed are appended to the dead-letter file.
+type ElasticsearchWriter struct {
+	url     string
+	options elasticsearchOptions
+
+	mu      sync.Mutex
+	pending []elasticsearchDoc
+	size    int
+	closed  bool
+
+	// sendMu serializes bulk requests
+	sendMu sync.Mutex
+	body   []byte
+
+	deadLetterMu sync.Mutex
+	failed       atomic.Uint64
+
+	// spoolDriven is set when the writer is wrapped by SpoolWriter
+	spoolDriven atomic.Bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewElasticsearchWriter creates a new [ElasticsearchWriter] sending documents to the Elasticsearch
+// with given URL (e.g. "https://localhost:9200"). It should be closed by [ElasticsearchWriter.Close].
+func NewElasticsearchWriter(url string, options ...ElasticsearchOption) *ElasticsearchWriter {
+	opts := elasticsearchOptions{
+		client:         http.DefaultClient,
+		batchSize:      1 << 20,
+		flushInterval:  time.Second,
+		maxRetries:     3,
+		initialBackoff: 100 * time.Millisecond,
+		maxBackoff:     10 * time.Second,
+		dataset:        "generic",
+		namespace:      "default",
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	w := &ElasticsearchWriter{
+		url:     strings.TrimSuffix(url, "/"),
+		options: opts,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write buffers each line of p as a separate document. When the buffer reaches the batch size,
+// the documents are sent as by [ElasticsearchWriter.Flush].
+func (w *ElasticsearchWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return 0, ErrClosed
+	}
+
+	for line := range bytes.Lines(p) {
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if len(line) == 0 {
+			continue
+		}
+		w.pending = append(w.pending, elasticsearchDoc{
+			index: w.index(line),
+			line:  bytes.Clone(line),
+		})
+		w.size += len(line)
+	}
+	full := w.size >= w.options.batchSize && !w.spoolDriven.Load()
+	w.mu.Unlock()
+
+	if full {
+		return len(p), w.Flush(context.Background())
+	}
+	return len(p), nil
+}
+
+// Failed returns the number of documents which could not be indexed.
+func (w *ElasticsearchWriter) Failed() uint64 {
+	return w.failed.Load()
+}
+
+// Flush sends all buffered documents. The returned error describes the last failure of the bulk
+// request, the failed documents are already written to the dead-letter file. When all the failed
+// documents were rejected with status other than 429 or 5xx, the error is [*RejectedError].
+//
+// When the writer is wrapped by [SpoolWriter], the documents which could still be indexed are kept
+// in the buffer instead of the dead-letter file and sent again with the next flush.
+func (w *ElasticsearchWriter) Flush(ctx context.Context) error {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+
+	w.mu.Lock()
+	docs := w.pending
+	w.pending = nil
+	w.size = 0
+	w.mu.Unlock()
+
+	if len(docs) == 0 {
+		return nil
+	}
+	return w.send(ctx, docs)
+}
+
+// Close sends all buffered documents and stops the background flushing.
+func (w *ElasticsearchWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.stop)
+	<-w.done
+
+	return w.Flush(ctx)
+}
+
+func (w *ElasticsearchWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.options.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if w.spoolDriven.Load() {
+				continue
+			}
+			// failures are handled by the dead-letter file
+			_ = w.Flush(context.Background())
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// send must be called with w.sendMu held
+func (w *ElasticsearchWriter) send(ctx context.Context, docs []elasticsearchDoc) error {
+	backoff := newBackoff(w.options.initialBackoff, w.options.maxBackoff)
+	for attempt := 0; ; attempt++ {
+		retry, failed, err := w.bulk(ctx, docs)
+		w.deadLetter(failed)
+		if len(retry) == 0 {
+			if err != nil {
+				// the documents would be rejected again
+				return &RejectedError{Err: err}
+			}
+			return nil
+		}
+
+		if attempt >= w.options.maxRetries {
+			return w.giveUp(retry, err)
+		}
+
+		if !backoff.wait(ctx.Done()) {
+			return w.giveUp(retry, ctx.Err())
+		}
+		docs = retry
+	}
+}
+
+// giveUp dead-letters the documents which could not be indexed in time, or keeps them for the next
+// flush when the writer is wrapped by SpoolWriter, which would otherwise replay them
+func (w *ElasticsearchWriter) giveUp(docs []elasticsearchDoc, err error) error {
+	if !w.spoolDriven.Load() {
+		w.deadLetter(docs)
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, doc := range docs {
+		w.size += len(doc.line)
+	}
+	w.pending = append(docs, w.pending...)
+	return retainedError{err: err}
+}
+
+// setSpoolDriven implements spoolDriven
+func (w *ElasticsearchWriter) setSpoolDriven() {
+	w.spoolDriven.Store(true)
+}
+
+// bulkResponse holds the parts of the bulk API response used for retries
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// bulk sends a single bulk request and sorts the documents, which were not indexed
+func (w *ElasticsearchWriter) bulk(ctx context.Context, docs []elasticsearchDoc) (retry, failed []elasticsearchDoc, err error) {
+	body := w.body[:0]
+	for _, doc := range docs {
+		body = append(body, `{"create":{"_index":`...)
+		body = appendJsonString(body, doc.index)
+		body = append(body, "}}\n"...)
+		body = append(body, doc.line...)
+		body = append(body, '\n')
+	}
+	w.body = body
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url+"/_bulk", bytes.NewReader(body))
+	if err != nil {
+		return nil, docs, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if w.options.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+w.options.apiKey)
+	} else if w.options.username != "" {
+		req.SetBasicAuth(w.options.username, w.options.password)
+	}
+
+	resp, err := w.options.client.Do(req)
+	if err != nil {
+		return docs, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case isRetryableStatus(resp.StatusCode):
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return docs, nil, fmt.Errorf("ecslog: bulk request failed with status %d", resp.StatusCode)
+	case resp.StatusCode/100 != 2:
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, docs, fmt.Errorf("ecslog: bulk request failed with status %d", resp.StatusCode)
+	}
+
+	var result bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, docs, fmt.Errorf("ecslog: invalid bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil, nil, nil
+	}
+	if len(result.Items) != len(docs) {
+		return nil, docs, errors.New("ecslog: invalid bulk response: mismatched number of items")
+	}
+
+	for i, item := range result.Items {
+		for _, action := range item {
+			switch {
+			case action.Status/100 == 2:
+			case isRetryableStatus(action.Status):
+				retry = append(retry, docs[i])
+				err = fmt.Errorf("ecslog: document rejected with status %d: %s", action.Status, action.Error)
+			default:
+				failed = append(failed, docs[i])
+				err = fmt.Errorf("ecslog: document rejected with status %d: %s", action.Status, action.Error)
+			}
+		}
+	}
+	return retry, failed, err
+}
+
+func (w *ElasticsearchWriter) deadLetter(docs []elasticsearchDoc) {
+	if len(docs) == 0 {
+		return
+	}
+	w.failed.Add(uint64(len(docs)))
+	if w.options.deadLetterPath == "" {
+		return
+	}
+
+	w.deadLetterMu.Lock()
+	defer w.deadLetterMu.Unlock()
+
+	f, err := os.OpenFile(w.options.deadLetterPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	var buff []byte
+	for _, doc := range docs {
+		buff = append(buff, doc.line...)
+		buff = append(buff, '\n')
+	}
+	_, _ = f.Write(buff)
+}
+
+// elasticsearchRouting holds fields of the record used for the data stream name
+type elasticsearchRouting struct {
+	DataStream struct {
+		Type      string `json:"type"`
+		Dataset   string `json:"dataset"`
+		Namespace string `json:"namespace"`
+	} `json:"data_stream"`
+	Event struct {
+		Dataset string `json:"dataset"`
+	} `json:"event"`
+}
+
+func (w *ElasticsearchWriter) index(line []byte) string {
+	var routing elasticsearchRouting
+	_ = json.Unmarshal(line, &routing)
+
+	return sanitizeIndexPart(cmp.Or(routing.DataStream.Type, "logs")) + "-" +
+		sanitizeIndexPart(cmp.Or(routing.DataStream.Dataset, routing.Event.Dataset, w.options.dataset)) + "-" +
+		sanitizeIndexPart(cmp.Or(routing.DataStream.Namespace, w.options.namespace))
+}
+
+// sanitizeIndexPart replaces characters not allowed in data stream name parts
+func sanitizeIndexPart(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '\\', '/', '*', '?', '"', '<', '>', '|', ',', '#', ':', ' ':
+			return '_'
+		}
+		return r
+	}, strings.ToLower(value))
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
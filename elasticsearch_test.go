@@ -0,0 +1,276 @@
+package ecslog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type bulkAction struct {
+	index string
+	doc   map[string]any
+}
+
+// fakeElasticsearch is a minimal bulk API, status function decides the status of each document
+type fakeElasticsearch struct {
+	mu       sync.Mutex
+	requests int
+	indexed  []bulkAction
+	auth     []string
+	status   func(request int, doc map[string]any) int
+}
+
+func (f *fakeElasticsearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var items []string
+	hasErrors := false
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		var action map[string]map[string]string
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		scanner.Scan()
+		var doc map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		status := f.status(f.requests, doc)
+		if status == http.StatusCreated {
+			f.indexed = append(f.indexed, bulkAction{index: action["create"]["_index"], doc: doc})
+		} else {
+			hasErrors = true
+		}
+		items = append(items, fmt.Sprintf(`{"create":{"status":%d}}`, status))
+	}
+
+	_, _ = fmt.Fprintf(w, `{"errors":%t,"items":[%s]}`, hasErrors, strings.Join(items, ","))
+}
+
+func TestElasticsearchWriter_Routing(t *testing.T) {
+	fake := &fakeElasticsearch{status: func(int, map[string]any) int { return http.StatusCreated }}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	w := NewElasticsearchWriter(server.URL, WithElasticsearchAPIKey("secret"))
+	ecs := slog.New(NewHandler(w))
+
+	ecs.Info("default")
+	ecs.Info("dataset", slog.String("event.dataset", "App-Audit"))
+	ecs.Info("data stream",
+		slog.String("event.dataset", "ignored"),
+		slog.String("data_stream.type", "metrics"),
+		slog.String("data_stream.dataset", "app"),
+		slog.String("data_stream.namespace", "prod"),
+	)
+
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"logs-generic-default", "logs-app_audit-default", "metrics-app-prod"}
+	if len(fake.indexed) != len(expected) {
+		t.Fatalf("expected %d documents, got %d", len(expected), len(fake.indexed))
+	}
+	for i, index := range expected {
+		if fake.indexed[i].index != index {
+			t.Errorf("expected index %s, got %s", index, fake.indexed[i].index)
+		}
+	}
+	if fake.requests != 1 || fake.auth[0] != "ApiKey secret" {
+		t.Errorf("unexpected requests: %d %v", fake.requests, fake.auth)
+	}
+}
+
+func TestElasticsearchWriter_RetryDeadLetter(t *testing.T) {
+	fake := &fakeElasticsearch{status: func(request int, doc map[string]any) int {
+		switch doc["message"] {
+		case "throttled":
+			if request == 1 {
+				return http.StatusTooManyRequests
+			}
+		case "invalid":
+			return http.StatusBadRequest
+		case "unavailable":
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusCreated
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	deadLetterPath := filepath.Join(t.TempDir(), "dead-letter.ndjson")
+	w := NewElasticsearchWriter(server.URL,
+		WithElasticsearchBasicAuth("user", "pass"),
+		WithElasticsearchRetries(2, time.Millisecond, time.Millisecond),
+		WithElasticsearchDeadLetterFile(deadLetterPath),
+	)
+	ecs := slog.New(NewHandler(w))
+
+	ecs.Info("ok")
+	ecs.Info("throttled")
+	ecs.Info("invalid")
+	ecs.Info("unavailable")
+
+	if err := w.Close(context.Background()); err == nil {
+		t.Error("close should report the failure")
+	}
+
+	if len(fake.indexed) != 2 || fake.indexed[0].doc["message"] != "ok" || fake.indexed[1].doc["message"] != "throttled" {
+		t.Errorf("unexpected indexed documents: %v", fake.indexed)
+	}
+	if fake.requests != 3 {
+		t.Errorf("expected 3 requests, got %d", fake.requests)
+	}
+	if w.Failed() != 2 {
+		t.Errorf("expected 2 failed documents, got %d", w.Failed())
+	}
+
+	f, err := os.Open(deadLetterPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var messages []any
+	for _, line := range unmarshalLogs(t, f) {
+		messages = append(messages, line["message"])
+	}
+	if len(messages) != 2 || messages[0] != "invalid" || messages[1] != "unavailable" {
+		t.Errorf("unexpected dead-letter documents: %v", messages)
+	}
+}
+
+func TestElasticsearchWriter_BatchSize(t *testing.T) {
+	fake := &fakeElasticsearch{status: func(int, map[string]any) int { return http.StatusCreated }}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	w := NewElasticsearchWriter(server.URL,
+		WithElasticsearchBatchSize(1),
+		WithElasticsearchFlushInterval(time.Hour),
+	)
+	defer func() { _ = w.Close(context.Background()) }()
+
+	ecs := slog.New(NewHandler(w))
+	ecs.Info("first")
+	ecs.Info("second")
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.requests != 2 || len(fake.indexed) != 2 {
+		t.Errorf("expected a request per document, got %d requests", fake.requests)
+	}
+}
+
+func TestElasticsearchWriter_SpoolRejected(t *testing.T) {
+	fake := &fakeElasticsearch{status: func(_ int, doc map[string]any) int {
+		if doc["message"] == "invalid" {
+			return http.StatusBadRequest
+		}
+		return http.StatusCreated
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	out := NewElasticsearchWriter(server.URL, WithElasticsearchFlushInterval(time.Hour))
+	defer func() { _ = out.Close(context.Background()) }()
+	s, err := NewSpoolWriter(t.TempDir(), out, WithSpoolBackoff(time.Millisecond, 5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSpoolLines(t, s, `{"message":"first"}`, `{"message":"invalid"}`, `{"message":"second"}`)
+
+	// the rejected line is dead-lettered and removed from the spool instead of being retried
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.requests != 1 || len(fake.indexed) != 2 {
+		t.Errorf("expected 2 documents indexed by 1 request, got %d documents in %d requests", len(fake.indexed), fake.requests)
+	}
+	if out.Failed() != 1 {
+		t.Errorf("expected 1 failed document, got %d", out.Failed())
+	}
+}
+
+func TestElasticsearchWriter_SpoolRetained(t *testing.T) {
+	fake := &fakeElasticsearch{status: func(request int, doc map[string]any) int {
+		switch doc["message"] {
+		case "invalid":
+			return http.StatusBadRequest
+		case "unavailable":
+			if request <= 2 {
+				return http.StatusServiceUnavailable
+			}
+		}
+		return http.StatusCreated
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	deadLetterPath := filepath.Join(t.TempDir(), "dead-letter.ndjson")
+	out := NewElasticsearchWriter(server.URL,
+		WithElasticsearchFlushInterval(time.Millisecond),
+		WithElasticsearchRetries(1, time.Millisecond, time.Millisecond),
+		WithElasticsearchDeadLetterFile(deadLetterPath),
+	)
+	defer func() { _ = out.Close(context.Background()) }()
+	s, err := NewSpoolWriter(t.TempDir(), out, WithSpoolBackoff(time.Millisecond, 5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSpoolLines(t, s, `{"message":"first"}`, `{"message":"invalid"}`, `{"message":"unavailable"}`)
+
+	// the document which exhausted the retries is kept by the writer and sent with the next
+	// flush of the spool, neither dead-lettered nor replayed with the other documents
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.requests != 3 || len(fake.indexed) != 2 {
+		t.Errorf("expected 2 documents indexed by 3 requests, got %d documents in %d requests", len(fake.indexed), fake.requests)
+	}
+	if out.Failed() != 1 {
+		t.Errorf("expected 1 failed document, got %d", out.Failed())
+	}
+
+	f, err := os.Open(deadLetterPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	if lines := unmarshalLogs(t, f); len(lines) != 1 || lines[0]["message"] != "invalid" {
+		t.Errorf("unexpected dead-letter documents: %v", lines)
+	}
+}
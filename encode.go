@@ -0,0 +1,768 @@
+package ecslog
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// encodeFunc appends JSON encoding of v to output
+type encodeFunc func(output []byte, v reflect.Value, state *encodeState) []byte
+
+// encoderCache maps reflect.Type to its encodeFunc
+var encoderCache sync.Map
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	jsonNumberType    = reflect.TypeFor[json.Number]()
+	rawMessageType    = reflect.TypeFor[json.RawMessage]()
+	timeType          = reflect.TypeFor[time.Time]()
+)
+
+// encodeRef identifies pointer, map or slice being encoded, the type distinguishes
+// a struct from its first field
+type encodeRef struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// encodeState tracks the pointers, maps and slices being encoded to detect cycles
+type encodeState struct {
+	stack []encodeRef
+}
+
+var encodeStatePool = sync.Pool{
+	New: func() any { return &encodeState{} },
+}
+
+// enter reports whether v is not being encoded already,
+// every successful enter must be followed by leave
+func (s *encodeState) enter(v reflect.Value) bool {
+	ref := encodeRef{ptr: uintptr(v.UnsafePointer()), typ: v.Type()}
+	if slices.Contains(s.stack, ref) {
+		return false
+	}
+	s.stack = append(s.stack, ref)
+	return true
+}
+
+func (s *encodeState) leave() {
+	s.stack = s.stack[:len(s.stack)-1]
+}
+
+// appendReflect encodes v as encoding/json does, with the exception of non-finite floats
+// encoded as strings and cycles encoded as null
+func appendReflect(output []byte, v any, state *encodeState) []byte {
+	if state == nil {
+		state = encodeStatePool.Get().(*encodeState)
+		// the stack may be left over by a panicking marshaler
+		state.stack = state.stack[:0]
+		defer encodeStatePool.Put(state)
+	}
+	rv := reflect.ValueOf(v)
+	return typeEncoder(rv.Type())(output, rv, state)
+}
+
+// typeEncoder returns cached encodeFunc of type t, compiling it on first use
+func typeEncoder(t reflect.Type) encodeFunc {
+	if f, ok := encoderCache.Load(t); ok {
+		return f.(encodeFunc)
+	}
+
+	// recursive types get the indirect func waiting for the compilation to finish
+	var (
+		wg sync.WaitGroup
+		f  encodeFunc
+	)
+	wg.Add(1)
+	indirect, loaded := encoderCache.LoadOrStore(t, encodeFunc(func(output []byte, v reflect.Value, state *encodeState) []byte {
+		wg.Wait()
+		return f(output, v, state)
+	}))
+	if loaded {
+		return indirect.(encodeFunc)
+	}
+
+	f = newTypeEncoder(t, true)
+	wg.Done()
+	encoderCache.Store(t, f)
+	return f
+}
+
+func newTypeEncoder(t reflect.Type, allowAddr bool) encodeFunc {
+	// methods with pointer receivers are used only when the value is addressable
+	if t.Kind() != reflect.Pointer && allowAddr {
+		if reflect.PointerTo(t).Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+			return condAddrEncoder(newTypeEncoder(reflect.PointerTo(t), false), newTypeEncoder(t, false))
+		}
+	}
+	// common types are encoded without calling their marshalers, which allocate
+	switch t {
+	case timeType:
+		return encodeTime
+	case rawMessageType:
+		return encodeRawMessage
+	case jsonNumberType:
+		return encodeNumber
+	}
+	if t.Implements(jsonMarshalerType) {
+		return encodeMarshaler
+	}
+	if t.Implements(textMarshalerType) {
+		return encodeTextMarshaler
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return encodeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return encodeInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return encodeUint
+	case reflect.Float32:
+		return encodeFloat32
+	case reflect.Float64:
+		return encodeFloat64
+	case reflect.String:
+		return encodeString
+	case reflect.Interface:
+		return encodeInterface
+	case reflect.Struct:
+		return newStructEncoder(t)
+	case reflect.Map:
+		return newMapEncoder(t)
+	case reflect.Slice:
+		return newSliceEncoder(t)
+	case reflect.Array:
+		return newArrayEncoder(t)
+	case reflect.Pointer:
+		return newPointerEncoder(t)
+	default:
+		// channels, functions and complex numbers have no JSON representation
+		return encodeNull
+	}
+}
+
+func condAddrEncoder(addrEncoder, elseEncoder encodeFunc) encodeFunc {
+	return func(output []byte, v reflect.Value, state *encodeState) []byte {
+		if v.CanAddr() {
+			return addrEncoder(output, v.Addr(), state)
+		}
+		return elseEncoder(output, v, state)
+	}
+}
+
+func encodeNull(output []byte, _ reflect.Value, _ *encodeState) []byte {
+	return append(output, "null"...)
+}
+
+func encodeMarshaler(output []byte, v reflect.Value, _ *encodeState) []byte {
+	if isNilValue(v) {
+		return append(output, "null"...)
+	}
+	b, err := v.Interface().(json.Marshaler).MarshalJSON()
+	if err != nil {
+		return appendJsonString(output, "ERR! "+err.Error())
+	}
+	return appendCompactJSON(output, b)
+}
+
+func encodeTextMarshaler(output []byte, v reflect.Value, _ *encodeState) []byte {
+	if isNilValue(v) {
+		return append(output, "null"...)
+	}
+	text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return appendJsonString(output, "ERR! "+err.Error())
+	}
+	return appendJsonString(output, text)
+}
+
+func encodeTime(output []byte, v reflect.Value, _ *encodeState) []byte {
+	t, _ := reflect.TypeAssert[time.Time](v)
+	return appendTime(output, t)
+}
+
+func encodeRawMessage(output []byte, v reflect.Value, _ *encodeState) []byte {
+	if v.IsNil() {
+		return append(output, "null"...)
+	}
+	return appendCompactJSON(output, v.Bytes())
+}
+
+// isNilValue reports whether v is nil pointer or interface, whose methods cannot be called
+func isNilValue(v reflect.Value) bool {
+	return (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil()
+}
+
+func encodeNumber(output []byte, v reflect.Value, _ *encodeState) []byte {
+	return appendJsonNumber(output, json.Number(v.String()))
+}
+
+// appendJsonNumber appends the number literal, invalid numbers are encoded as strings
+func appendJsonNumber(output []byte, number json.Number) []byte {
+	if number == "" {
+		number = "0"
+	}
+	if !isJsonNumber(string(number)) {
+		return appendJsonString(output, string(number))
+	}
+	return append(output, number...)
+}
+
+// isJsonNumber reports whether s is a valid JSON number literal
+func isJsonNumber(s string) bool {
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	digits := func(i int) int {
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+		return i
+	}
+
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(s) && s[i] == '0':
+		i++
+	case i < len(s) && isDigit(s[i]):
+		i = digits(i)
+	default:
+		return false
+	}
+	if i < len(s) && s[i] == '.' {
+		if i++; !(i < len(s) && isDigit(s[i])) {
+			return false
+		}
+		i = digits(i)
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		if i++; i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		if !(i < len(s) && isDigit(s[i])) {
+			return false
+		}
+		i = digits(i)
+	}
+	return i == len(s)
+}
+
+func encodeBool(output []byte, v reflect.Value, _ *encodeState) []byte {
+	return strconv.AppendBool(output, v.Bool())
+}
+
+func encodeInt(output []byte, v reflect.Value, _ *encodeState) []byte {
+	return strconv.AppendInt(output, v.Int(), 10)
+}
+
+func encodeUint(output []byte, v reflect.Value, _ *encodeState) []byte {
+	return strconv.AppendUint(output, v.Uint(), 10)
+}
+
+func encodeFloat32(output []byte, v reflect.Value, _ *encodeState) []byte {
+	return appendFloat(output, v.Float(), 32)
+}
+
+func encodeFloat64(output []byte, v reflect.Value, _ *encodeState) []byte {
+	return appendFloat(output, v.Float(), 64)
+}
+
+func encodeString(output []byte, v reflect.Value, _ *encodeState) []byte {
+	return appendJsonString(output, v.String())
+}
+
+func encodeInterface(output []byte, v reflect.Value, state *encodeState) []byte {
+	if v.IsNil() {
+		return append(output, "null"...)
+	}
+	return appendAny(output, v.Interface(), state)
+}
+
+// appendFloat encodes f as encoding/json does, but NaN and infinities are encoded
+// as strings "NaN", "+Inf" and "-Inf" instead of failing
+func appendFloat(output []byte, f float64, bits int) []byte {
+	switch {
+	case math.IsNaN(f):
+		return append(output, `"NaN"`...)
+	case math.IsInf(f, 1):
+		return append(output, `"+Inf"`...)
+	case math.IsInf(f, -1):
+		return append(output, `"-Inf"`...)
+	}
+
+	// the exponent is used for very small and very large numbers as in ES6
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) ||
+			bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	output = strconv.AppendFloat(output, f, format, -1, bits)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		if n := len(output); n >= 4 && output[n-4] == 'e' && output[n-3] == '-' && output[n-2] == '0' {
+			output[n-2] = output[n-1]
+			output = output[:n-1]
+		}
+	}
+	return output
+}
+
+// appendCompactJSON appends b without insignificant white space, invalid JSON is encoded as string
+func appendCompactJSON(output []byte, b []byte) []byte {
+	if !json.Valid(b) {
+		return appendJsonString(output, "ERR! invalid JSON: "+string(b))
+	}
+	if !bytes.ContainsAny(b, " \t\r\n") {
+		return append(output, b...)
+	}
+
+	inString, escaped := false, false
+	for _, c := range b {
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			continue
+		}
+		output = append(output, c)
+	}
+	return output
+}
+
+// structField is a field of the encoding plan of a struct
+type structField struct {
+	name   string
+	tagged bool
+	// index is the path to the field through embedded structs
+	index []int
+	typ   reflect.Type
+
+	// key is pre-encoded `"name":`
+	key       []byte
+	omitEmpty bool
+	omitZero  bool
+	encode    encodeFunc
+}
+
+func newStructEncoder(t reflect.Type) encodeFunc {
+	fields := structFields(t)
+	return func(output []byte, v reflect.Value, state *encodeState) []byte {
+		output = append(output, '{')
+		first := true
+	fields:
+		for i := range fields {
+			field := &fields[i]
+			fv := v
+			for _, index := range field.index {
+				if fv.Kind() == reflect.Pointer {
+					// fields of nil embedded pointers are omitted
+					if fv.IsNil() {
+						continue fields
+					}
+					fv = fv.Elem()
+				}
+				fv = fv.Field(index)
+			}
+			if field.omitEmpty && isEmptyValue(fv) || field.omitZero && isZeroValue(fv) {
+				continue
+			}
+
+			if !first {
+				output = append(output, ',')
+			}
+			first = false
+			output = append(output, field.key...)
+			output = field.encode(output, fv, state)
+		}
+		return append(output, '}')
+	}
+}
+
+// structFields returns the fields of struct t encoded by encoding/json
+// including the promoted fields of embedded structs
+func structFields(t reflect.Type) []structField {
+	type scan struct {
+		typ   reflect.Type
+		index []int
+	}
+
+	var fields []structField
+	current, next := []scan{}, []scan{{typ: t}}
+	count, nextCount := map[reflect.Type]int{}, map[reflect.Type]int{t: 1}
+	visited := map[reflect.Type]bool{}
+
+	// breadth-first search over embedded structs, so shallower fields come first
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		count, nextCount = nextCount, map[reflect.Type]int{}
+
+		for _, s := range current {
+			if visited[s.typ] {
+				continue
+			}
+			visited[s.typ] = true
+
+			for i := range s.typ.NumField() {
+				sf := s.typ.Field(i)
+				if sf.Anonymous {
+					ft := sf.Type
+					if ft.Kind() == reflect.Pointer {
+						ft = ft.Elem()
+					}
+					// unexported embedded structs may still have exported fields
+					if !sf.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, options, _ := strings.Cut(tag, ",")
+				if !isValidFieldName(name) {
+					name = ""
+				}
+				index := append(slices.Clip(s.index), i)
+
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+
+				// embedded structs without a name are explored on the next level
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					nextCount[ft]++
+					if nextCount[ft] == 1 {
+						next = append(next, scan{typ: ft, index: index})
+					}
+					continue
+				}
+
+				field := structField{
+					name:      name,
+					tagged:    name != "",
+					index:     index,
+					typ:       sf.Type,
+					omitEmpty: hasTagOption(options, "omitempty"),
+					omitZero:  hasTagOption(options, "omitzero"),
+					encode:    typeEncoder(sf.Type),
+				}
+				if field.name == "" {
+					field.name = sf.Name
+				}
+				if hasTagOption(options, "string") {
+					if encode := quotedEncoder(sf.Type); encode != nil {
+						field.encode = encode
+					}
+				}
+				fields = append(fields, field)
+				if count[s.typ] > 1 {
+					// the struct is embedded multiple times on this level, so the fields annihilate
+					fields = append(fields, field)
+				}
+			}
+		}
+	}
+
+	// the dominant field wins among the fields with the same name
+	slices.SortFunc(fields, func(a, b structField) int {
+		if c := strings.Compare(a.name, b.name); c != 0 {
+			return c
+		}
+		if c := len(a.index) - len(b.index); c != 0 {
+			return c
+		}
+		if a.tagged != b.tagged {
+			if a.tagged {
+				return -1
+			}
+			return 1
+		}
+		return slices.Compare(a.index, b.index)
+	})
+	dominant := fields[:0]
+	for i := 0; i < len(fields); {
+		n := 1
+		for i+n < len(fields) && fields[i+n].name == fields[i].name {
+			n++
+		}
+		if n == 1 || len(fields[i].index) < len(fields[i+1].index) || fields[i].tagged != fields[i+1].tagged {
+			dominant = append(dominant, fields[i])
+		}
+		i += n
+	}
+	fields = dominant
+
+	slices.SortFunc(fields, func(a, b structField) int {
+		return slices.Compare(a.index, b.index)
+	})
+	for i := range fields {
+		fields[i].key = append(appendJsonString(nil, fields[i].name), ':')
+	}
+	return fields
+}
+
+// quotedEncoder returns the encoder of `json:",string"` fields of type t, which encodes the values
+// as JSON strings, or nil when the option does not apply to the type
+func quotedEncoder(t reflect.Type) encodeFunc {
+	elem := t
+	if t.Name() == "" && t.Kind() == reflect.Pointer {
+		elem = t.Elem()
+	}
+	if elem.Implements(jsonMarshalerType) || elem.Implements(textMarshalerType) {
+		return nil
+	}
+
+	var quote encodeFunc
+	switch elem.Kind() {
+	case reflect.String:
+		if elem == jsonNumberType {
+			quote = func(output []byte, v reflect.Value, _ *encodeState) []byte {
+				return appendJsonString(output, v.String())
+			}
+			break
+		}
+		quote = func(output []byte, v reflect.Value, state *encodeState) []byte {
+			// the string is encoded after the encoded string and moved in its place
+			start := len(output)
+			output = appendJsonString(output, v.String())
+			encoded := output[start:]
+			output = appendJsonString(output, encoded)
+			n := copy(output[start:], output[start+len(encoded):])
+			return output[:start+n]
+		}
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+
+		encode := typeEncoder(elem)
+		quote = func(output []byte, v reflect.Value, state *encodeState) []byte {
+			start := len(output)
+			output = append(output, '"')
+			output = encode(output, v, state)
+			// non-finite floats are quoted already
+			if output[start+1] == '"' {
+				return append(output[:start], output[start+1:]...)
+			}
+			return append(output, '"')
+		}
+	default:
+		return nil
+	}
+
+	if elem == t {
+		return quote
+	}
+	return func(output []byte, v reflect.Value, state *encodeState) []byte {
+		if v.IsNil() {
+			return append(output, "null"...)
+		}
+		return quote(output, v.Elem(), state)
+	}
+}
+
+func hasTagOption(options, option string) bool {
+	for options != "" {
+		var name string
+		name, options, _ = strings.Cut(options, ",")
+		if name == option {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidFieldName reports whether the name from json tag is used by encoding/json
+func isValidFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", c):
+		case !unicode.IsLetter(c) && !unicode.IsDigit(c):
+			return false
+		}
+	}
+	return true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+// isZeroValue reports whether v is zero for `omitzero`, using IsZero method when there is one
+func isZeroValue(v reflect.Value) bool {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return true
+	}
+	if z, ok := v.Interface().(interface{ IsZero() bool }); ok {
+		return z.IsZero()
+	}
+	return v.IsZero()
+}
+
+func newMapEncoder(t reflect.Type) encodeFunc {
+	keyType := t.Key()
+	switch keyType.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		if !keyType.Implements(textMarshalerType) {
+			return encodeNull
+		}
+	}
+	encodeElem := typeEncoder(t.Elem())
+
+	type entry struct {
+		key   string
+		value reflect.Value
+	}
+	return func(output []byte, v reflect.Value, state *encodeState) []byte {
+		if v.IsNil() {
+			return append(output, "null"...)
+		}
+		if !state.enter(v) {
+			return append(output, "null"...)
+		}
+
+		// keys are sorted as by encoding/json
+		entries := make([]entry, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, ok := mapKeyString(iter.Key())
+			if !ok {
+				continue
+			}
+			entries = append(entries, entry{key: key, value: iter.Value()})
+		}
+		slices.SortFunc(entries, func(a, b entry) int {
+			return strings.Compare(a.key, b.key)
+		})
+
+		output = append(output, '{')
+		for i := range entries {
+			output = appendKey(output, i > 0, entries[i].key)
+			output = encodeElem(output, entries[i].value, state)
+		}
+		state.leave()
+		return append(output, '}')
+	}
+}
+
+func mapKeyString(key reflect.Value) (string, bool) {
+	switch key.Kind() {
+	case reflect.String:
+		return key.String(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), true
+	}
+	if key.Kind() == reflect.Pointer && key.IsNil() {
+		return "", true
+	}
+	text, err := key.Interface().(encoding.TextMarshaler).MarshalText()
+	return string(text), err == nil
+}
+
+func newSliceEncoder(t reflect.Type) encodeFunc {
+	// byte slices are encoded as base64 unless the bytes marshal themselves
+	elem := t.Elem()
+	if elem.Kind() == reflect.Uint8 {
+		pElem := reflect.PointerTo(elem)
+		if !pElem.Implements(jsonMarshalerType) && !pElem.Implements(textMarshalerType) {
+			return encodeBytes
+		}
+	}
+
+	encodeArray := newArrayEncoder(t)
+	return func(output []byte, v reflect.Value, state *encodeState) []byte {
+		if v.IsNil() {
+			return append(output, "null"...)
+		}
+		if !state.enter(v) {
+			return append(output, "null"...)
+		}
+		output = encodeArray(output, v, state)
+		state.leave()
+		return output
+	}
+}
+
+func encodeBytes(output []byte, v reflect.Value, _ *encodeState) []byte {
+	if v.IsNil() {
+		return append(output, "null"...)
+	}
+	output = append(output, '"')
+	output = base64.StdEncoding.AppendEncode(output, v.Bytes())
+	return append(output, '"')
+}
+
+func newArrayEncoder(t reflect.Type) encodeFunc {
+	encodeElem := typeEncoder(t.Elem())
+	return func(output []byte, v reflect.Value, state *encodeState) []byte {
+		output = append(output, '[')
+		for i := range v.Len() {
+			if i > 0 {
+				output = append(output, ',')
+			}
+			output = encodeElem(output, v.Index(i), state)
+		}
+		return append(output, ']')
+	}
+}
+
+func newPointerEncoder(t reflect.Type) encodeFunc {
+	encodeElem := typeEncoder(t.Elem())
+	return func(output []byte, v reflect.Value, state *encodeState) []byte {
+		if v.IsNil() {
+			return append(output, "null"...)
+		}
+		if !state.enter(v) {
+			return append(output, "null"...)
+		}
+		output = encodeElem(output, v.Elem(), state)
+		state.leave()
+		return output
+	}
+}
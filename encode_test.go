@@ -0,0 +1,274 @@
+package ecslog
+
+import (
+	"encoding/json"
+	"math"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type encodeTestAddress struct {
+	Street string `json:"street"`
+	City   string `json:"city,omitempty"`
+}
+
+type encodeTestBase struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+	Name    string
+}
+
+type encodeTestAudit struct {
+	Name    string `json:"name"`
+	Version int
+}
+
+type encodeTestHidden struct {
+	Hidden string
+}
+
+type encodeTestOrder struct {
+	encodeTestBase
+	*encodeTestAudit
+	encodeTestHidden
+
+	Customer  string              `json:"customer"`
+	Secret    string              `json:"-"`
+	Dash      string              `json:"-,"`
+	Amount    float64             `json:"amount"`
+	Quantity  int64               `json:"quantity,string"`
+	Paid      bool                `json:",string"`
+	Discount  *float32            `json:"discount,omitempty"`
+	Note      *string             `json:"note,string"`
+	Shipping  *encodeTestAddress  `json:"shipping"`
+	Billing   *encodeTestAddress  `json:"billing,omitempty"`
+	Items     []encodeTestItem    `json:"items"`
+	Tags      []string            `json:"tags,omitempty"`
+	Labels    map[string]string   `json:"labels"`
+	Counts    map[int]int         `json:"counts"`
+	Networks  map[netip.Addr]bool `json:"networks"`
+	Payload   []byte              `json:"payload"`
+	Digest    [4]byte             `json:"digest"`
+	Extra     any                 `json:"extra"`
+	Raw       json.RawMessage     `json:"raw"`
+	Number    json.Number         `json:"number"`
+	Timeout   time.Duration       `json:"timeout"`
+	Empty     struct{}            `json:"empty"`
+	Status    encodeTestStatus    `json:"status"`
+	private   string
+	Uppercase string `json:"UPPER"`
+}
+
+type encodeTestItem struct {
+	SKU   string  `json:"sku"`
+	Price float64 `json:"price"`
+	Next  *encodeTestItem
+}
+
+type encodeTestStatus int
+
+func (s *encodeTestStatus) MarshalText() ([]byte, error) {
+	return []byte("status-" + string(rune('0'+*s))), nil
+}
+
+type encodeTestConflict struct {
+	encodeTestConflictA
+	encodeTestConflictB
+	Depth string
+}
+
+type encodeTestConflictA struct {
+	Zip   string
+	Label string `json:"Name"`
+	Depth string
+}
+
+type encodeTestConflictB struct {
+	Zip  string
+	Name string
+}
+
+type encodeTestOmitZero struct {
+	Time  time.Time `json:"time,omitzero"`
+	Count int       `json:"count,omitzero"`
+	Items []int     `json:"items,omitzero"`
+}
+
+func encodeTestNewOrder() *encodeTestOrder {
+	discount := float32(0.1)
+	note := `"fragile" \ handle with care`
+	return &encodeTestOrder{
+		encodeTestBase:   encodeTestBase{ID: 7, Created: time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC), Name: "base"},
+		encodeTestAudit:  &encodeTestAudit{Name: "audit", Version: 2},
+		encodeTestHidden: encodeTestHidden{Hidden: "promoted"},
+		Customer:         "john <john@example.com>",
+		Secret:           "secret",
+		Dash:             "dash",
+		Amount:           1e21,
+		Quantity:         3,
+		Paid:             true,
+		Discount:         &discount,
+		Note:             &note,
+		Shipping:         &encodeTestAddress{Street: "Main \"1\""},
+		Items: []encodeTestItem{
+			{SKU: "a", Price: 0.000001, Next: &encodeTestItem{SKU: "b", Price: 1e-7}},
+			{SKU: "c", Price: -12.5},
+		},
+		Labels:   map[string]string{"b": "2", "a": "1"},
+		Counts:   map[int]int{10: 1, 2: 2, -1: 3},
+		Networks: map[netip.Addr]bool{netip.MustParseAddr("10.0.0.1"): true},
+		Payload:  []byte("payload"),
+		Digest:   [4]byte{1, 2, 3, 4},
+		Extra:    map[string]any{"nested": []any{1, "two", nil, encodeTestAddress{Street: "x"}}},
+		Raw:      json.RawMessage(`{ "raw" : [1, 2] }`),
+		Number:   "12.5e3",
+		Timeout:  time.Second,
+		Status:   3,
+		private:  "private",
+	}
+}
+
+// values encoded as by encoding/json
+var encodeTestData = []struct {
+	name  string
+	value any
+}{
+	{"Struct", *encodeTestNewOrder()},
+	{"StructPointer", encodeTestNewOrder()},
+	{"StructZero", encodeTestOrder{}},
+	{"Conflict", encodeTestConflict{encodeTestConflictA{"a", "b", "c"}, encodeTestConflictB{"d", "e"}, "f"}},
+	{"OmitZero", encodeTestOmitZero{Items: []int{}}},
+	{"OmitZeroSet", encodeTestOmitZero{Time: time.Unix(1, 0).UTC(), Count: 1}},
+	{"Slice", []encodeTestAddress{{Street: "a"}, {City: "b"}}},
+	{"SliceNil", []encodeTestAddress(nil)},
+	{"MapStruct", map[string]*encodeTestAddress{"home": {Street: "a"}, "work": nil}},
+	{"MapNil", map[string]int(nil)},
+	{"NamedBytes", json.RawMessage(`[1,2]`)},
+	{"Floats", []float64{0, -0.0, 1, 1.5, 1e20, 1e21, 1e-6, 1e-7, 123456789.123, math.MaxFloat64, math.SmallestNonzeroFloat64}},
+	{"Float32", []float32{0.1, 1e-7, 3.4e38, 16777216}},
+	{"Ints", []int8{-128, 127}},
+	{"Uints", []uint64{0, math.MaxUint64}},
+	{"Interface", []any{nil, true, "s", 1.5, []int{1}, map[string]any{"a": nil}}},
+}
+
+// values encoded differently than by encoding/json
+var encodeTestSpecialData = []struct {
+	name     string
+	value    any
+	expected string
+}{
+	{"NaN", math.NaN(), `"NaN"`},
+	{"Inf", []float64{math.Inf(1), math.Inf(-1)}, `["+Inf","-Inf"]`},
+	{"NaNField", struct {
+		Value float32 `json:"value"`
+		Quote float64 `json:"quote,string"`
+		Count int     `json:"count,string"`
+	}{float32(math.NaN()), math.Inf(1), 1}, `{"value":"NaN","quote":"+Inf","count":"1"}`},
+	{"Unsupported", struct {
+		F func()
+		C chan int
+		X complex128
+		N int
+	}{F: func() {}, N: 1}, `{"F":null,"C":null,"X":null,"N":1}`},
+	{"Error", struct{ Err any }{Err: errMarshalTest}, `{"Err":"marshal test"}`},
+	{"InvalidNumber", struct{ N json.Number }{"12a"}, `{"N":"12a"}`},
+}
+
+var errMarshalTest = &encodeTestError{}
+
+type encodeTestError struct{}
+
+func (*encodeTestError) Error() string { return "marshal test" }
+
+type encodeTestNode struct {
+	Name     string
+	Parent   *encodeTestNode
+	Children []*encodeTestNode
+	Meta     map[string]any
+}
+
+func TestAppendReflect(t *testing.T) {
+	for _, data := range encodeTestData {
+		t.Run(data.name, func(t *testing.T) {
+			expected := marshalJSON(t, data.value)
+			if output := appendJsonAny(nil, data.value); string(output) != string(expected) {
+				t.Errorf("mismatched output\nEXP: %s\nGOT: %s", expected, output)
+			}
+		})
+	}
+	for _, data := range encodeTestSpecialData {
+		t.Run(data.name, func(t *testing.T) {
+			output := appendJsonAny(nil, data.value)
+			if string(output) != data.expected || !json.Valid(output) {
+				t.Errorf("expected %s, got %s", data.expected, output)
+			}
+		})
+	}
+}
+
+func TestAppendReflect_Cycle(t *testing.T) {
+	root := &encodeTestNode{Name: "root", Meta: map[string]any{}}
+	child := &encodeTestNode{Name: "child", Parent: root}
+	root.Children = []*encodeTestNode{child}
+	root.Meta["self"] = root.Meta
+	root.Meta["root"] = root
+
+	output := appendJsonAny(nil, root)
+	if !json.Valid(output) {
+		t.Fatalf("invalid output: %s", output)
+	}
+	if !strings.Contains(string(output), `"Parent":null`) || !strings.Contains(string(output), `"self":null`) {
+		t.Errorf("cycles are not cut with null: %s", output)
+	}
+
+	// deep values without cycles are encoded as they are
+	var list *encodeTestItem
+	for range 100 {
+		list = &encodeTestItem{SKU: "item", Next: list}
+	}
+	if output, expected := appendJsonAny(nil, list), marshalJSON(t, list); string(output) != string(expected) {
+		t.Errorf("mismatched output\nEXP: %s\nGOT: %s", expected, output)
+	}
+}
+
+func TestAppendReflect_Concurrent(t *testing.T) {
+	type concurrentTest struct {
+		Self  *concurrentTest
+		Items []concurrentTest
+		Value int
+	}
+	value := concurrentTest{Self: &concurrentTest{Value: 1}, Items: []concurrentTest{{Value: 2}}}
+	expected := marshalJSON(t, value)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			if output := appendJsonAny(nil, value); string(output) != string(expected) {
+				t.Errorf("mismatched output\nEXP: %s\nGOT: %s", expected, output)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func BenchmarkAppendReflect(b *testing.B) {
+	order := encodeTestNewOrder()
+	order.Labels, order.Counts, order.Networks, order.Extra = nil, nil, nil, nil
+	output := make([]byte, 0, 4096)
+
+	b.Run("Reflect", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			output = appendJsonAny(output[:0], order)
+		}
+	})
+	b.Run("EncodingJSON", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			output, _ = json.Marshal(order)
+		}
+	})
+}
@@ -0,0 +1,288 @@
+package ecslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxExpandDepth limits expansion of nested structs, so cyclic values are not expanded forever
+const maxExpandDepth = 16
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// Fields returns attribute which is expanded to attributes of the fields of struct v tagged
+// with `ecs:"<dotted key>"`, so they are merged with other attributes instead of being logged
+// as single JSON object.
+//
+//	type User struct {
+//		Name  string   `ecs:"user.name"`
+//		Roles []string `ecs:"user.roles,omitempty"`
+//	}
+//
+//	logger.With(slog.String("user.domain", "example.com")).Info("login", ecslog.Fields(user))
+//	// {"user": {"domain": "example.com", "name": "john", "roles": ["admin"]}, ...}
+//
+// The [Handler] expands such structs passed as slog.Any("", v) as well. Fields of nested structs
+// with ecs tags are expanded with the key of the field as prefix, untagged embedded structs are
+// expanded as if their fields were promoted and fields without the tag are ignored. The option
+// omitempty omits false, 0, nil pointers and interfaces and empty arrays, maps, slices and strings.
+//
+// The attribute is resolved to a group with empty key, so other handlers inline the fields as well.
+func Fields(v any) slog.Attr {
+	return slog.Any("", fieldsValuer{value: v})
+}
+
+type fieldsValuer struct {
+	value any
+}
+
+func (f fieldsValuer) LogValue() slog.Value {
+	return slog.GroupValue(appendStructFields(nil, "", reflect.ValueOf(f.value), 0)...)
+}
+
+// expandAttr returns the attributes to which an attribute with empty key expands, which are
+// the attributes of inlined group or the tagged fields of struct (see [Fields]), and optionally
+// the attributes to which a map value expands (see [WithMapExpansion])
+func expandAttr(attr slog.Attr, expandMaps bool) ([]slog.Attr, bool) {
+	if attr.Key != "" {
+		if expandMaps {
+			return expandMapAttr(attr)
+		}
+		return nil, false
+	}
+
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		// per slog.Handler doc we should inline groups with empty key
+		return value.Group(), true
+	case slog.KindAny:
+		v := reflect.ValueOf(value.Any())
+		if t := indirectType(v.Type()); t == nil || len(ecsStructFields(t)) == 0 {
+			return nil, false
+		}
+		return appendStructFields(nil, "", v, 0), true
+	}
+	return nil, false
+}
+
+// expandMapAttr returns the attributes of the entries of map value prefixed by the key of the attribute
+func expandMapAttr(attr slog.Attr) ([]slog.Attr, bool) {
+	value := attr.Value.Resolve()
+	if value.Kind() != slog.KindAny {
+		return nil, false
+	}
+	return appendMapAttrs(nil, attr.Key, value.Any(), 0)
+}
+
+// appendMapAttrs appends the attributes of the entries of map v prefixed by key. The nested maps
+// are expanded as well up to maxExpandDepth, deeper maps are kept as values, so cyclic maps
+// are not expanded forever.
+func appendMapAttrs(attrs []slog.Attr, key string, v any, depth int) ([]slog.Attr, bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		return appendMapEntries(attrs, key, v, depth)
+	case map[string]string:
+		return appendMapEntries(attrs, key, v, depth)
+	case json.RawMessage:
+		if trimmed := bytes.TrimLeft(v, " \t\r\n"); len(trimmed) == 0 || trimmed[0] != '{' {
+			return attrs, false
+		}
+		dec := json.NewDecoder(bytes.NewReader(v))
+		dec.UseNumber()
+		var decoded map[string]any
+		if err := dec.Decode(&decoded); err != nil {
+			return attrs, false
+		}
+		return appendMapEntries(attrs, key, decoded, depth)
+	}
+	return attrs, false
+}
+
+func appendMapEntries[V any](attrs []slog.Attr, key string, m map[string]V, depth int) ([]slog.Attr, bool) {
+	if len(m) == 0 {
+		return attrs, false
+	}
+	for name := range m {
+		if name == "" {
+			return attrs, false
+		}
+	}
+
+	// the order of the attributes does not matter, as they are sorted by the handler
+	for name, entry := range m {
+		var value any = entry
+		if depth < maxExpandDepth {
+			if expanded, ok := appendMapAttrs(attrs, key+"."+name, value, depth+1); ok {
+				attrs = expanded
+				continue
+			}
+		} else if isExpandableMap(value) {
+			// the handler would expand the map again
+			value = unexpandedMap{value: value}
+		}
+		attrs = append(attrs, slog.Any(key+"."+name, value))
+	}
+	return attrs, true
+}
+
+func isExpandableMap(v any) bool {
+	switch v.(type) {
+	case map[string]any, map[string]string, json.RawMessage:
+		return true
+	}
+	return false
+}
+
+// unexpandedMap is map nested deeper than maxExpandDepth, which is encoded as a value
+type unexpandedMap struct {
+	value any
+}
+
+func (m unexpandedMap) MarshalJSON() ([]byte, error) {
+	return appendJsonAny(nil, m.value), nil
+}
+
+// ecsField is a field of struct tagged with `ecs:"..."`
+type ecsField struct {
+	key string
+	// index is the path to the field through embedded structs
+	index     []int
+	omitEmpty bool
+}
+
+// ecsFieldsCache maps reflect.Type of struct to its []ecsField
+var ecsFieldsCache sync.Map
+
+// ecsStructFields returns the tagged fields of struct t including the fields of untagged embedded structs
+func ecsStructFields(t reflect.Type) []ecsField {
+	if fields, ok := ecsFieldsCache.Load(t); ok {
+		return fields.([]ecsField)
+	}
+	fields := appendEcsStructFields(nil, t, nil, map[reflect.Type]bool{})
+	fields = fields[:len(fields):len(fields)]
+	ecsFieldsCache.Store(t, fields)
+	return fields
+}
+
+func appendEcsStructFields(fields []ecsField, t reflect.Type, index []int, visited map[reflect.Type]bool) []ecsField {
+	if visited[t] {
+		return fields
+	}
+	visited[t] = true
+
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("ecs")
+		fieldIndex := append(index[:len(index):len(index)], i)
+
+		if !ok && sf.Anonymous {
+			if ft := indirectType(sf.Type); ft != nil {
+				fields = appendEcsStructFields(fields, ft, fieldIndex, visited)
+			}
+			continue
+		}
+		key, options, _ := strings.Cut(tag, ",")
+		if !sf.IsExported() || key == "" || key == "-" {
+			continue
+		}
+		fields = append(fields, ecsField{
+			key:       key,
+			index:     fieldIndex,
+			omitEmpty: hasTagOption(options, "omitempty"),
+		})
+	}
+	return fields
+}
+
+// indirectType returns the struct type of t or of the struct t points to, or nil
+func indirectType(t reflect.Type) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+// appendStructFields appends the attributes of tagged fields of struct v with prefixed keys
+func appendStructFields(attrs []slog.Attr, prefix string, v reflect.Value, depth int) []slog.Attr {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return attrs
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return attrs
+	}
+
+	for _, field := range ecsStructFields(v.Type()) {
+		fv, ok := fieldByIndex(v, field.index)
+		if !ok || field.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+
+		// nested structs with tagged fields are expanded as well
+		if t := indirectType(fv.Type()); t != nil && depth < maxExpandDepth && len(ecsStructFields(t)) > 0 {
+			attrs = appendStructFields(attrs, prefix+field.key+".", fv, depth+1)
+			continue
+		}
+		attrs = append(attrs, slog.Attr{Key: prefix + field.key, Value: reflectSlogValue(fv)})
+	}
+	return attrs
+}
+
+// fieldByIndex returns the field of v, it fails when an embedded struct pointer is nil
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, fieldIndex := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(fieldIndex)
+	}
+	return v, true
+}
+
+// reflectSlogValue returns slog.Value of v, values of predeclared types are converted
+// to the respective kinds without allocation
+func reflectSlogValue(v reflect.Value) slog.Value {
+	switch v.Type() {
+	case timeType:
+		t, _ := reflect.TypeAssert[time.Time](v)
+		return slog.TimeValue(t)
+	case durationType:
+		return slog.DurationValue(time.Duration(v.Int()))
+	}
+
+	if v.Type().PkgPath() == "" {
+		switch v.Kind() {
+		case reflect.String:
+			return slog.StringValue(v.String())
+		case reflect.Bool:
+			return slog.BoolValue(v.Bool())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return slog.Int64Value(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return slog.Uint64Value(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			return slog.Float64Value(v.Float())
+		}
+	}
+	if v.Kind() == reflect.Interface && v.IsNil() {
+		return slog.AnyValue(nil)
+	}
+	return slog.AnyValue(v.Interface())
+}
@@ -0,0 +1,259 @@
+package ecslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type expandTestGroup struct {
+	Name string `ecs:"name"`
+	ID   int    `ecs:"id,omitempty"`
+}
+
+type expandTestLabels struct {
+	Tier string `ecs:"labels.tier"`
+}
+
+type expandTestOrg struct {
+	Name string `ecs:"organization.name"`
+}
+
+type expandTestUser struct {
+	expandTestLabels
+	*expandTestOrg
+
+	Name    string           `ecs:"user.name"`
+	Roles   []string         `ecs:"user.roles,omitempty"`
+	Email   string           `ecs:"user.email,omitempty"`
+	Group   *expandTestGroup `ecs:"user.group"`
+	Level   slog.Level       `ecs:"labels.level"`
+	Created time.Time        `ecs:"event.created"`
+	Ignored string
+	Skipped string `ecs:"-"`
+}
+
+var expandTestUserValue = expandTestUser{
+	expandTestLabels: expandTestLabels{Tier: "gold"},
+	Name:             "john",
+	Roles:            []string{"admin"},
+	Group:            &expandTestGroup{Name: "staff"},
+	Level:            slog.LevelWarn,
+	Created:          time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	Ignored:          "ignored",
+	Skipped:          "skipped",
+}
+
+var expandTestUserOutput = val{
+	"user": val{
+		"domain": "example.com",
+		"name":   "john",
+		"roles":  arr{"admin"},
+		"group":  val{"name": "staff"},
+	},
+	"labels": val{"tier": "gold", "level": "WARN"},
+	"event":  val{"created": "2024-01-02T03:04:05Z"},
+}
+
+var expandTestData = []struct {
+	name     string
+	f        func(l *slog.Logger)
+	expected val
+}{
+	{
+		"Fields",
+		func(l *slog.Logger) {
+			l.With(slog.String("user.domain", "example.com")).Info("", Fields(expandTestUserValue))
+		},
+		expandTestUserOutput,
+	},
+	{
+		"AnyEmptyKey",
+		func(l *slog.Logger) {
+			l.With(slog.String("user.domain", "example.com")).Info("", slog.Any("", &expandTestUserValue))
+		},
+		expandTestUserOutput,
+	},
+	{
+		"WithAttrs",
+		func(l *slog.Logger) {
+			l.With(Fields(expandTestUserValue), slog.String("user.domain", "example.com")).
+				Info("", slog.String("user.name", "jane"), slog.Any("", expandTestOrg{Name: "acme"}))
+		},
+		val{
+			"user": val{
+				"domain": "example.com",
+				"name":   "jane",
+				"roles":  arr{"admin"},
+				"group":  val{"name": "staff"},
+			},
+			"labels":       val{"tier": "gold", "level": "WARN"},
+			"event":        val{"created": "2024-01-02T03:04:05Z"},
+			"organization": val{"name": "acme"},
+		},
+	},
+	{
+		"WithGroup",
+		func(l *slog.Logger) {
+			l.WithGroup("source").Info("", Fields(expandTestGroup{Name: "staff", ID: 1}))
+		},
+		val{"source": val{"name": "staff", "id": float64(1)}},
+	},
+	{
+		"EmbeddedPointer",
+		func(l *slog.Logger) {
+			l.Info("", Fields(expandTestUser{expandTestOrg: &expandTestOrg{Name: "acme"}}))
+		},
+		val{
+			"user":         val{"name": ""},
+			"labels":       val{"tier": "", "level": "INFO"},
+			"event":        val{"created": "0001-01-01T00:00:00Z"},
+			"organization": val{"name": "acme"},
+		},
+	},
+	{
+		"NilPointer",
+		func(l *slog.Logger) {
+			l.Info("", Fields((*expandTestUser)(nil)), slog.String("user.name", "john"))
+		},
+		val{"user": val{"name": "john"}},
+	},
+	{
+		"Untagged",
+		func(l *slog.Logger) {
+			l.Info("", slog.Any("", struct{ Name string }{"john"}))
+		},
+		val{"": val{"Name": "john"}},
+	},
+	{
+		"InlineGroup",
+		func(l *slog.Logger) {
+			l.With(slog.Group("", slog.String("user.name", "john"))).
+				Info("", slog.Group("", slog.String("user.id", "1")))
+		},
+		val{"user": val{"name": "john", "id": "1"}},
+	},
+}
+
+func TestFields(t *testing.T) {
+	for _, data := range expandTestData {
+		t.Run(data.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			data.f(slog.New(NewHandler(buff, WithTimestamp(false))))
+
+			expected := data.expected
+			expected["log"] = val{"level": "INFO"}
+			output := unmarshalLogs(t, buff)
+			if len(output) != 1 || !reflect.DeepEqual(output[0], expected) {
+				t.Errorf("mismatched output\nEXP: %v\nGOT: %v", expected, output)
+			}
+		})
+	}
+}
+
+func TestFields_JSONHandler(t *testing.T) {
+	buff := &bytes.Buffer{}
+	slog.New(slog.NewJSONHandler(buff, nil)).Info("", Fields(expandTestGroup{Name: "staff"}))
+
+	if output := buff.String(); !strings.Contains(output, `"msg":"","name":"staff"}`) {
+		t.Errorf("fields are not inlined: %s", output)
+	}
+}
+
+var mapExpansionTestData = []struct {
+	name     string
+	f        func(l *slog.Logger)
+	expected val
+}{
+	{
+		"Map",
+		func(l *slog.Logger) {
+			l.With(slog.String("labels.team", "payments"), slog.String("labels.env", "prod")).
+				Info("", slog.Any("labels", map[string]any{"team": "checkout", "tier": 1}))
+		},
+		val{"labels": val{"team": "checkout", "tier": float64(1), "env": "prod"}},
+	},
+	{
+		"WithAttrs",
+		func(l *slog.Logger) {
+			l.With(slog.Any("labels", map[string]string{"team": "payments", "tier": "backend"})).
+				Info("", slog.String("labels.team", "checkout"))
+		},
+		val{"labels": val{"team": "checkout", "tier": "backend"}},
+	},
+	{
+		"Nested",
+		func(l *slog.Logger) {
+			l.WithGroup("request").Info("", slog.Any("body", map[string]any{
+				"user":  map[string]any{"id": "1", "roles": []string{"admin"}},
+				"tags":  map[string]string{"a": "b"},
+				"raw":   json.RawMessage(`{"x": {"y": 1.50}}`),
+				"empty": map[string]any{},
+			}))
+		},
+		val{"request": val{"body": val{
+			"user":  val{"id": "1", "roles": arr{"admin"}},
+			"tags":  val{"a": "b"},
+			"raw":   val{"x": val{"y": float64(1.5)}},
+			"empty": val{},
+		}}},
+	},
+	{
+		"RawMessage",
+		func(l *slog.Logger) {
+			l.With(slog.String("event.kind", "event")).
+				Info("", slog.Any("event", json.RawMessage(` {"action": "login", "outcome": "success"}`)))
+		},
+		val{"event": val{"kind": "event", "action": "login", "outcome": "success"}},
+	},
+	{
+		"NotExpanded",
+		func(l *slog.Logger) {
+			l.Info("",
+				slog.Any("list", json.RawMessage(`[1, 2]`)),
+				slog.Any("invalid", json.RawMessage(`{"a": }`)),
+				slog.Any("labels", map[string]string{"": "empty key"}),
+			)
+		},
+		val{"list": arr{float64(1), float64(2)}, "invalid": `ERR! invalid JSON: {"a": }`, "labels": val{"": "empty key"}},
+	},
+}
+
+func TestWithMapExpansion(t *testing.T) {
+	for _, data := range mapExpansionTestData {
+		t.Run(data.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			data.f(slog.New(NewHandler(buff, WithTimestamp(false), WithMapExpansion(true))))
+
+			expected := data.expected
+			expected["log"] = val{"level": "INFO"}
+			output := unmarshalLogs(t, buff)
+			if len(output) != 1 || !reflect.DeepEqual(output[0], expected) {
+				t.Errorf("mismatched output\nEXP: %v\nGOT: %v", expected, output)
+			}
+		})
+	}
+}
+
+func TestWithMapExpansion_Cycle(t *testing.T) {
+	m := map[string]any{"name": "loop"}
+	m["self"] = m
+
+	buff := &bytes.Buffer{}
+	slog.New(NewHandler(buff, WithTimestamp(false), WithMapExpansion(true))).Info("", slog.Any("labels", m))
+
+	// the map is expanded up to the depth limit, the rest is encoded with the cycle cut by null
+	nested := val{"name": "loop", "self": val{"name": "loop", "self": nil}}
+	for range maxExpandDepth {
+		nested = val{"name": "loop", "self": nested}
+	}
+	expected := val{"log": val{"level": "INFO"}, "labels": nested}
+	output := unmarshalLogs(t, buff)
+	if len(output) != 1 || !reflect.DeepEqual(output[0], expected) {
+		t.Errorf("mismatched output\nEXP: %v\nGOT: %v", expected, output)
+	}
+}
@@ -2,6 +2,7 @@ package ecslog
 
 import (
 	"log/slog"
+	"strings"
 )
 
 const groupSeparator = '.'
@@ -42,3 +43,62 @@ func isEarlierKey(a, b string) int {
 
 	return len(b) - len(a)
 }
+
+// mergeSortedAttrs appends attributes of slices sorted by isEarlierAttr to dst, keeping them sorted.
+// Attributes with the same key are kept in the order of a, b and c, as if sorted stably.
+func mergeSortedAttrs(dst, a, b, c []slog.Attr) []slog.Attr {
+	for len(a)+len(b)+len(c) > 0 {
+		next := &a
+		if len(b) > 0 && (len(*next) == 0 || isEarlierAttr(b[0], (*next)[0]) < 0) {
+			next = &b
+		}
+		if len(c) > 0 && (len(*next) == 0 || isEarlierAttr(c[0], (*next)[0]) < 0) {
+			next = &c
+		}
+		dst = append(dst, (*next)[0])
+		*next = (*next)[1:]
+	}
+	return dst
+}
+
+// dedupSortedAttrs removes attributes followed by an attribute with the same key,
+// as only the last one is logged
+func dedupSortedAttrs(attrs []slog.Attr) []slog.Attr {
+	deduped := attrs[:0]
+	for i, attr := range attrs {
+		if i+1 < len(attrs) && attrs[i+1].Key == attr.Key {
+			continue
+		}
+		deduped = append(deduped, attr)
+	}
+	return deduped
+}
+
+// findAttrValue returns the value of attribute with given dotted key,
+// looking into groups
+func findAttrValue(attr slog.Attr, prefix, key string) (slog.Value, bool) {
+	fullKey := prefix + attr.Key
+	if fullKey == key {
+		return unwrapPreformatted(attr.Value.Resolve()), true
+	}
+	if !strings.HasPrefix(key, fullKey) {
+		return slog.Value{}, false
+	}
+
+	value := unwrapPreformatted(attr.Value.Resolve())
+	if value.Kind() != slog.KindGroup {
+		return slog.Value{}, false
+	}
+	if attr.Key != "" {
+		fullKey += "."
+	}
+
+	var found slog.Value
+	var ok bool
+	for _, groupAttr := range value.Group() {
+		if v, groupOk := findAttrValue(groupAttr, fullKey, key); groupOk {
+			found, ok = v, true
+		}
+	}
+	return found, ok
+}
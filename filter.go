@@ -0,0 +1,641 @@
+package ecslog
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// FilterRule is a rule of [FilterHandler] deciding whether the record is dropped or kept.
+// The rules are created by [ParseFilterRule] from the textual form:
+//
+//	drop if url.path == "/healthz"
+//	keep if log.level >= warn or event.dataset == "audit"
+//	drop if http.response.status_code in [200, 204] and event.duration < 10ms
+//
+// The condition compares attributes given by dotted keys with values, the conditions can be
+// combined using "and", "or", "not" and parentheses. Supported operators are ==, !=, <, <=, >, >=
+// and "in" or "not in" with a list of values. The values may be:
+//
+//   - strings in double quotes, compared with the string representation of the attribute,
+//   - numbers, compared with numeric attributes,
+//   - durations (e.g. 10ms), compared with duration attributes or numeric attributes in nanoseconds
+//     (as "event.duration" of ECS),
+//   - levels (debug, info, warn, error), compared with the level of the attribute,
+//   - true and false.
+//
+// The key "message" refers to the message of the record. Comparisons of missing attributes or attributes
+// of different type do not match, except != which matches.
+type FilterRule struct {
+	source string
+	keep   bool
+	cond   filterCond
+}
+
+// ParseFilterRule parses the rule in textual form, see [FilterRule].
+func ParseFilterRule(rule string) (*FilterRule, error) {
+	tokens, err := lexFilterRule(rule)
+	if err != nil {
+		return nil, fmt.Errorf("ecslog: invalid filter rule %q: %w", rule, err)
+	}
+
+	p := &filterParser{tokens: tokens}
+	r, err := p.parseRule()
+	if err != nil {
+		return nil, fmt.Errorf("ecslog: invalid filter rule %q: %w", rule, err)
+	}
+	r.source = strings.TrimSpace(rule)
+	return r, nil
+}
+
+// ParseFilterRules parses the rules separated by new lines. Empty lines and lines starting
+// with # are ignored.
+func ParseFilterRules(rules string) ([]*FilterRule, error) {
+	var parsed []*FilterRule
+	for line := range strings.Lines(rules) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule, err := ParseFilterRule(line)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, rule)
+	}
+	return parsed, nil
+}
+
+// String returns the rule in textual form.
+func (r *FilterRule) String() string {
+	return r.source
+}
+
+// filter holds the state shared by FilterHandler and its derived handlers
+type filter struct {
+	rules   atomic.Pointer[[]*FilterRule]
+	dropped atomic.Uint64
+}
+
+// keep evaluates the rules, the first matching rule decides
+func (f *filter) keep(message string, sortedAttrs []slog.Attr) bool {
+	rules := *f.rules.Load()
+
+	hasKeep := false
+	for _, rule := range rules {
+		if rule.cond.match(message, sortedAttrs) {
+			return rule.keep
+		}
+		hasKeep = hasKeep || rule.keep
+	}
+	return !hasKeep
+}
+
+// FilterHandler is [Handler] wrapper which drops records according to [FilterRule] list.
+// The rules are evaluated in order against all attributes of the record, including the attributes
+// of the handler, and the first matching rule decides. When no rule matches, the record is dropped
+// if there is any "keep" rule, otherwise it is kept.
+//
+// The rules may be replaced at runtime by [FilterHandler.SetRules], e.g. on configuration reload.
+//
+// The rules are evaluated against the same sorted attributes as used by [Handler], so the handler
+// must wrap [Handler] directly, other wrappers of this package, such as [SamplingHandler], may be
+// placed above it.
+type FilterHandler struct {
+	next   *Handler
+	filter *filter
+}
+
+// NewFilterHandler creates a new [FilterHandler] passing the kept records to next.
+func NewFilterHandler(next *Handler, rules ...*FilterRule) *FilterHandler {
+	f := &filter{}
+	f.rules.Store(&rules)
+
+	return &FilterHandler{
+		next:   next,
+		filter: f,
+	}
+}
+
+// SetRules replaces the rules of h and all handlers derived from it.
+func (h *FilterHandler) SetRules(rules ...*FilterRule) {
+	h.filter.rules.Store(&rules)
+}
+
+// Dropped returns the total number of dropped records.
+func (h *FilterHandler) Dropped() uint64 {
+	return h.filter.dropped.Load()
+}
+
+// Enabled reports whether the next handler handles records at given level.
+func (h *FilterHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle passes the record to the next handler, unless it is dropped by the rules.
+func (h *FilterHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handleWithAttrs(ctx, record, nil)
+}
+
+func (h *FilterHandler) handleWithAttrs(ctx context.Context, record slog.Record, extra []slog.Attr) error {
+	handleCtx := h.next.getHandleCtx()
+	attrs := h.next.appendAttrs(handleCtx, ctx, record, extra)
+	output := handleCtx.outputBuffer[:0]
+
+	var err error
+	if h.filter.keep(record.Message, attrs) {
+		output = h.next.appendRecord(output, record, attrs)
+		err = h.next.write(record.Level, output)
+	} else {
+		h.filter.dropped.Add(1)
+	}
+
+	h.next.putHandleCtx(handleCtx, output, attrs)
+	return err
+}
+
+// WithAttrs creates new [FilterHandler] sharing the rules with h.
+func (h *FilterHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &FilterHandler{
+		next:   h.next.WithAttrs(attrs).(*Handler),
+		filter: h.filter,
+	}
+}
+
+// WithGroup creates new [FilterHandler] sharing the rules with h.
+func (h *FilterHandler) WithGroup(name string) slog.Handler {
+	return &FilterHandler{
+		next:   h.next.WithGroup(name).(*Handler),
+		filter: h.filter,
+	}
+}
+
+// filterCond is parsed condition of FilterRule
+type filterCond interface {
+	match(message string, sortedAttrs []slog.Attr) bool
+}
+
+type filterOr struct{ a, b filterCond }
+
+func (c filterOr) match(message string, attrs []slog.Attr) bool {
+	return c.a.match(message, attrs) || c.b.match(message, attrs)
+}
+
+type filterAnd struct{ a, b filterCond }
+
+func (c filterAnd) match(message string, attrs []slog.Attr) bool {
+	return c.a.match(message, attrs) && c.b.match(message, attrs)
+}
+
+type filterNot struct{ c filterCond }
+
+func (c filterNot) match(message string, attrs []slog.Attr) bool {
+	return !c.c.match(message, attrs)
+}
+
+// filterCompare compares the attribute with one of the values, != and "not in"
+// are represented by filterNot
+type filterCompare struct {
+	key    string
+	op     string
+	values []slog.Value
+}
+
+func (c filterCompare) match(message string, attrs []slog.Attr) bool {
+	value, ok := lookupFilterValue(message, attrs, c.key)
+	if !ok {
+		return false
+	}
+
+	for _, expected := range c.values {
+		result, ok := compareFilterValue(value, expected)
+		if !ok {
+			continue
+		}
+
+		switch c.op {
+		case "==":
+			if result == 0 {
+				return true
+			}
+		case "<":
+			return result < 0
+		case "<=":
+			return result <= 0
+		case ">":
+			return result > 0
+		case ">=":
+			return result >= 0
+		}
+	}
+	return false
+}
+
+// lookupFilterValue returns the last value of the attribute, as it is the value which is logged
+func lookupFilterValue(message string, attrs []slog.Attr, key string) (slog.Value, bool) {
+	if key == "message" {
+		return slog.StringValue(message), true
+	}
+
+	var found slog.Value
+	var ok bool
+	for _, attr := range attrs {
+		if v, attrOk := findAttrValue(attr, "", key); attrOk {
+			found, ok = v, true
+		}
+	}
+	return found, ok
+}
+
+// compareFilterValue compares the attribute value with the value of the rule,
+// ok is false when the values are not comparable
+func compareFilterValue(value, expected slog.Value) (result int, ok bool) {
+	switch expected.Kind() {
+	case slog.KindString:
+		return strings.Compare(value.String(), expected.String()), true
+	case slog.KindFloat64:
+		if n, ok := filterNumber(value); ok {
+			return cmp.Compare(n, expected.Float64()), true
+		}
+	case slog.KindDuration:
+		if value.Kind() == slog.KindDuration {
+			return cmp.Compare(value.Duration(), expected.Duration()), true
+		}
+		if n, ok := filterNumber(value); ok {
+			return cmp.Compare(n, float64(expected.Duration())), true
+		}
+	case slog.KindBool:
+		if value.Kind() == slog.KindBool {
+			return cmp.Compare(b2i(value.Bool()), b2i(expected.Bool())), true
+		}
+	case slog.KindAny:
+		if level, ok := filterLevel(value); ok {
+			return cmp.Compare(level, expected.Any().(slog.Level)), true
+		}
+	}
+	return 0, false
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func filterNumber(value slog.Value) (float64, bool) {
+	switch value.Kind() {
+	case slog.KindInt64:
+		return float64(value.Int64()), true
+	case slog.KindUint64:
+		return float64(value.Uint64()), true
+	case slog.KindFloat64:
+		return value.Float64(), true
+	case slog.KindDuration:
+		return float64(value.Duration()), true
+	default:
+		return 0, false
+	}
+}
+
+func filterLevel(value slog.Value) (slog.Level, bool) {
+	switch value.Kind() {
+	case slog.KindString:
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(value.String())); err != nil {
+			return 0, false
+		}
+		return level, true
+	case slog.KindInt64:
+		return slog.Level(value.Int64()), true
+	case slog.KindAny:
+		if leveler, ok := value.Any().(slog.Leveler); ok {
+			return leveler.Level(), true
+		}
+	}
+	return 0, false
+}
+
+type filterTokenKind int
+
+const (
+	filterTokenEOF filterTokenKind = iota
+	filterTokenIdent
+	filterTokenString
+	filterTokenNumber
+	filterTokenDuration
+	filterTokenOperator
+	filterTokenPunct
+)
+
+type filterToken struct {
+	kind  filterTokenKind
+	text  string
+	value slog.Value
+	pos   int
+}
+
+func isFilterIdentByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '@'
+}
+
+func lexFilterRule(rule string) ([]filterToken, error) {
+	var tokens []filterToken
+	i := 0
+	for i < len(rule) {
+		c := rule[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+			continue
+
+		case c == '(' || c == ')' || c == '[' || c == ']' || c == ',':
+			i++
+			tokens = append(tokens, filterToken{kind: filterTokenPunct, text: rule[start:i], pos: start})
+
+		case c == '=' || c == '!' || c == '<' || c == '>':
+			i++
+			if i < len(rule) && rule[i] == '=' {
+				i++
+			}
+			op := rule[start:i]
+			if op == "=" || op == "!" {
+				return nil, fmt.Errorf("unexpected %q at %d", op, start)
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenOperator, text: op, pos: start})
+
+		case c == '"':
+			i++
+			for i < len(rule) && rule[i] != '"' {
+				if rule[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(rule) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			s, err := strconv.Unquote(rule[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d: %w", start, err)
+			}
+			tokens = append(tokens, filterToken{
+				kind: filterTokenString, text: rule[start:i], value: slog.StringValue(s), pos: start,
+			})
+
+		case c >= '0' && c <= '9' || c == '-' || c == '.':
+			i++
+			for i < len(rule) && (isFilterIdentByte(rule[i]) || rule[i] == '+' || rule[i] == '-') {
+				i++
+			}
+			text := rule[start:i]
+			if n, err := strconv.ParseFloat(text, 64); err == nil {
+				tokens = append(tokens, filterToken{
+					kind: filterTokenNumber, text: text, value: slog.Float64Value(n), pos: start,
+				})
+			} else if d, err := time.ParseDuration(text); err == nil {
+				tokens = append(tokens, filterToken{
+					kind: filterTokenDuration, text: text, value: slog.DurationValue(d), pos: start,
+				})
+			} else {
+				return nil, fmt.Errorf("invalid number %q at %d", text, start)
+			}
+
+		case isFilterIdentByte(c):
+			for i < len(rule) && isFilterIdentByte(rule[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenIdent, text: rule[start:i], pos: start})
+
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", c, start)
+		}
+	}
+	return append(tokens, filterToken{kind: filterTokenEOF, pos: len(rule)}), nil
+}
+
+// filterParser is recursive descent parser of the rules:
+//
+//	rule    = ("drop" | "keep") "if" or
+//	or      = and { "or" and }
+//	and     = not { "and" not }
+//	not     = "not" not | "(" or ")" | compare
+//	compare = key op value | key ["not"] "in" "[" value { "," value } "]"
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	token := p.tokens[p.pos]
+	if token.kind != filterTokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+// accept consumes the next token if it is given keyword or punctuation
+func (p *filterParser) accept(text string) bool {
+	token := p.peek()
+	if (token.kind == filterTokenIdent || token.kind == filterTokenPunct) && strings.EqualFold(token.text, text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.accept(text) {
+		return unexpectedFilterToken(p.peek(), text)
+	}
+	return nil
+}
+
+func unexpectedFilterToken(token filterToken, expected string) error {
+	if token.kind == filterTokenEOF {
+		return fmt.Errorf("expected %s at end of rule", expected)
+	}
+	return fmt.Errorf("expected %s at %d, got %q", expected, token.pos, token.text)
+}
+
+func isFilterKeyword(text string) bool {
+	switch strings.ToLower(text) {
+	case "drop", "keep", "if", "and", "or", "not", "in":
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *filterParser) parseRule() (*FilterRule, error) {
+	rule := &FilterRule{}
+	switch {
+	case p.accept("drop"):
+	case p.accept("keep"):
+		rule.keep = true
+	default:
+		return nil, unexpectedFilterToken(p.peek(), `"drop" or "keep"`)
+	}
+	if err := p.expect("if"); err != nil {
+		return nil, err
+	}
+
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.kind != filterTokenEOF {
+		return nil, unexpectedFilterToken(token, `"and", "or" or end of rule`)
+	}
+	rule.cond = cond
+	return rule, nil
+}
+
+func (p *filterParser) parseOr() (filterCond, error) {
+	cond, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		other, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		cond = filterOr{cond, other}
+	}
+	return cond, nil
+}
+
+func (p *filterParser) parseAnd() (filterCond, error) {
+	cond, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		other, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		cond = filterAnd{cond, other}
+	}
+	return cond, nil
+}
+
+func (p *filterParser) parseNot() (filterCond, error) {
+	if p.accept("not") {
+		cond, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{cond}, nil
+	}
+
+	if p.accept("(") {
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return cond, nil
+	}
+
+	return p.parseCompare()
+}
+
+func (p *filterParser) parseCompare() (filterCond, error) {
+	key := p.next()
+	if key.kind != filterTokenIdent || isFilterKeyword(key.text) {
+		return nil, unexpectedFilterToken(key, "attribute key")
+	}
+
+	negate := p.accept("not")
+	if negate || p.accept("in") {
+		if negate {
+			if err := p.expect("in"); err != nil {
+				return nil, err
+			}
+		}
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		var cond filterCond = filterCompare{key: key.text, op: "==", values: values}
+		if negate {
+			cond = filterNot{cond}
+		}
+		return cond, nil
+	}
+
+	op := p.next()
+	if op.kind != filterTokenOperator {
+		return nil, unexpectedFilterToken(op, "operator")
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if op.text == "!=" {
+		return filterNot{filterCompare{key: key.text, op: "==", values: []slog.Value{value}}}, nil
+	}
+	return filterCompare{key: key.text, op: op.text, values: []slog.Value{value}}, nil
+}
+
+func (p *filterParser) parseList() ([]slog.Value, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+
+	var values []slog.Value
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		if p.accept("]") {
+			return values, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *filterParser) parseValue() (slog.Value, error) {
+	token := p.next()
+	switch token.kind {
+	case filterTokenString, filterTokenNumber, filterTokenDuration:
+		return token.value, nil
+	case filterTokenIdent:
+		switch strings.ToLower(token.text) {
+		case "true":
+			return slog.BoolValue(true), nil
+		case "false":
+			return slog.BoolValue(false), nil
+		}
+
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(token.text)); err == nil {
+			return slog.AnyValue(level), nil
+		}
+		return slog.Value{}, fmt.Errorf("unknown value %q at %d", token.text, token.pos)
+	default:
+		return slog.Value{}, unexpectedFilterToken(token, "value")
+	}
+}
@@ -0,0 +1,139 @@
+package ecslog
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var filterRuleTestData = []struct {
+	name  string
+	rules string
+	attrs []slog.Attr
+	level slog.Level
+	kept  bool
+}{
+	{"NoRules", "", nil, slog.LevelInfo, true},
+	{"DropString", `drop if url.path == "/healthz"`, []slog.Attr{slog.String("url.path", "/healthz")}, slog.LevelInfo, false},
+	{"DropOtherString", `drop if url.path == "/healthz"`, []slog.Attr{slog.String("url.path", "/api")}, slog.LevelInfo, true},
+	{"DropGroup", `drop if url.path == "/healthz"`, []slog.Attr{slog.Group("url", slog.String("path", "/healthz"))}, slog.LevelInfo, false},
+	{"DropMissing", `drop if url.path == "/healthz"`, nil, slog.LevelInfo, true},
+	{"NotEqualMissing", `drop if url.path != "/healthz"`, nil, slog.LevelInfo, false},
+	{"KeepLevel", `keep if log.level >= warn or event.dataset == "audit"`, nil, slog.LevelWarn, true},
+	{"KeepLevelBelow", `keep if log.level >= warn or event.dataset == "audit"`, nil, slog.LevelInfo, false},
+	{"KeepDataset", `keep if log.level >= warn or event.dataset == "audit"`, []slog.Attr{slog.String("event.dataset", "audit")}, slog.LevelInfo, true},
+	{
+		"InAndDuration", `drop if http.response.status_code in [200, 204] and event.duration < 10ms`,
+		[]slog.Attr{slog.Int("http.response.status_code", 204), slog.Int64("event.duration", int64(5*time.Millisecond))},
+		slog.LevelInfo, false,
+	},
+	{
+		"InAndDurationSlow", `drop if http.response.status_code in [200, 204] and event.duration < 10ms`,
+		[]slog.Attr{slog.Int("http.response.status_code", 204), slog.Duration("event.duration", time.Second)},
+		slog.LevelInfo, true,
+	},
+	{
+		"NotIn", `drop if http.response.status_code not in [200, 204]`,
+		[]slog.Attr{slog.Int("http.response.status_code", 500)}, slog.LevelInfo, false,
+	},
+	{
+		"Parentheses", `drop if not (event.dataset == "audit" or labels.important == true)`,
+		[]slog.Attr{slog.Bool("labels.important", true)}, slog.LevelInfo, true,
+	},
+	{"Message", `drop if message == "test"`, nil, slog.LevelInfo, false},
+	{"FirstMatch", "keep if url.path == \"/healthz\"\ndrop if url.path == \"/healthz\"", []slog.Attr{slog.String("url.path", "/healthz")}, slog.LevelInfo, true},
+	{"LastValue", `drop if event.dataset == "audit"`, []slog.Attr{slog.String("event.dataset", "audit"), slog.String("event.dataset", "access")}, slog.LevelInfo, true},
+}
+
+func TestFilterHandler(t *testing.T) {
+	for _, data := range filterRuleTestData {
+		t.Run(data.name, func(t *testing.T) {
+			rules, err := ParseFilterRules(data.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			buff := &bytes.Buffer{}
+			h := NewFilterHandler(NewHandler(buff, WithTimestamp(false), WithLogLevel(slog.LevelDebug)), rules...)
+			slog.New(h).LogAttrs(t.Context(), data.level, "test", data.attrs...)
+
+			if kept := buff.Len() > 0; kept != data.kept {
+				t.Errorf("expected kept %v, got %v", data.kept, kept)
+			}
+		})
+	}
+}
+
+func TestFilterHandler_SetRules(t *testing.T) {
+	buff := &bytes.Buffer{}
+	h := NewFilterHandler(NewHandler(buff, WithTimestamp(false)))
+	logger := slog.New(h).With("event.dataset", "access")
+
+	logger.Info("first")
+	rules, err := ParseFilterRules(`
+		# access logs are too noisy
+		drop if event.dataset == "access"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetRules(rules...)
+	logger.Info("second")
+
+	expected := []map[string]interface{}{
+		{"log": val{"level": "INFO"}, "message": "first", "event": val{"dataset": "access"}},
+	}
+	if output := unmarshalLogs(t, buff); !reflect.DeepEqual(output, expected) {
+		t.Errorf("mismatched output\nEXP: %v\nGOT: %v", expected, output)
+	}
+	if h.Dropped() != 1 {
+		t.Errorf("expected 1 dropped record, got %d", h.Dropped())
+	}
+}
+
+var filterRuleErrorTestData = []struct {
+	name string
+	rule string
+}{
+	{"Empty", ""},
+	{"Action", `ignore if a == 1`},
+	{"MissingIf", `drop a == 1`},
+	{"MissingValue", `drop if a ==`},
+	{"Assignment", `drop if a = 1`},
+	{"UnknownValue", `drop if a == audit`},
+	{"Unterminated", `drop if a == "audit`},
+	{"InvalidNumber", `drop if a < 10xs`},
+	{"UnclosedList", `drop if a in [1, 2`},
+	{"UnclosedParenthesis", `drop if (a == 1`},
+	{"Trailing", `drop if a == 1 b`},
+	{"KeywordKey", `drop if and == 1`},
+}
+
+func TestParseFilterRule_Error(t *testing.T) {
+	for _, data := range filterRuleErrorTestData {
+		t.Run(data.name, func(t *testing.T) {
+			if _, err := ParseFilterRule(data.rule); err == nil {
+				t.Errorf("expected error for %q", data.rule)
+			}
+		})
+	}
+}
+
+func BenchmarkFilterHandler(b *testing.B) {
+	rules, err := ParseFilterRules(`
+		drop if url.path == "/healthz"
+		drop if http.response.status_code in [200, 204] and event.duration < 10ms
+	`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	logger := slog.New(NewFilterHandler(NewHandler(io.Discard), rules...)).With("service.name", "test")
+
+	b.ReportAllocs()
+	for b.Loop() {
+		logger.Info("request", slog.String("url.path", "/api"), slog.Int("http.response.status_code", 500))
+	}
+}
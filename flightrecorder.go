@@ -0,0 +1,292 @@
+package ecslog
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+type flightRecorderOptions struct {
+	size         int
+	level        slog.Level
+	trigger      slog.Level
+	contextKey   any
+	perGoroutine bool
+	maxBuffers   int
+}
+
+// FlightRecorderOption configures [FlightRecorderHandler].
+type FlightRecorderOption func(*flightRecorderOptions)
+
+// WithFlightRecorderSize sets the number of records kept in each buffer. Default value is 100.
+func WithFlightRecorderSize(size int) FlightRecorderOption {
+	return func(o *flightRecorderOptions) {
+		o.size = max(size, 1)
+	}
+}
+
+// WithFlightRecorderLevel sets the minimum level of records kept in the buffer.
+// Default value is slog.LevelDebug.
+func WithFlightRecorderLevel(level slog.Level) FlightRecorderOption {
+	return func(o *flightRecorderOptions) {
+		o.level = level
+	}
+}
+
+// WithFlightRecorderTrigger sets the minimum level of records, which flush the buffer.
+// Default value is slog.LevelError.
+func WithFlightRecorderTrigger(level slog.Level) FlightRecorderOption {
+	return func(o *flightRecorderOptions) {
+		o.trigger = level
+	}
+}
+
+// WithFlightRecorderContextKey option can be used to keep separate buffer for each value
+// of given context key (e.g. request ID), so only the records related to the error are flushed.
+// The buffer should be discarded by [FlightRecorderHandler.Reset] when the request finishes.
+func WithFlightRecorderContextKey(key any) FlightRecorderOption {
+	return func(o *flightRecorderOptions) {
+		o.contextKey = key
+	}
+}
+
+// WithFlightRecorderPerGoroutine option can be used to keep separate buffer for each goroutine.
+// It is used when the context does not contain the key set by [WithFlightRecorderContextKey].
+//
+// Note that obtaining the goroutine ID is relatively expensive and the buffers of finished goroutines
+// are discarded only when the limit of buffers is reached, so [WithFlightRecorderContextKey] is preferred.
+func WithFlightRecorderPerGoroutine(perGoroutine bool) FlightRecorderOption {
+	return func(o *flightRecorderOptions) {
+		o.perGoroutine = perGoroutine
+	}
+}
+
+// WithFlightRecorderMaxBuffers sets the maximum number of separate buffers. When the limit is reached,
+// the least recently used buffer is discarded. Default value is 1024.
+func WithFlightRecorderMaxBuffers(maxBuffers int) FlightRecorderOption {
+	return func(o *flightRecorderOptions) {
+		o.maxBuffers = max(maxBuffers, 1)
+	}
+}
+
+// flightRing is ring buffer of encoded records, the lines are reused when overwritten
+type flightRing struct {
+	key    any
+	lines  [][]byte
+	levels []slog.Level
+	next   int
+	count  int
+}
+
+func (r *flightRing) push(level slog.Level, line []byte) {
+	r.lines[r.next] = append(r.lines[r.next][:0], line...)
+	r.levels[r.next] = level
+	r.next = (r.next + 1) % len(r.lines)
+	r.count = min(r.count+1, len(r.lines))
+}
+
+// flightRecorder holds the state shared by FlightRecorderHandler and its derived handlers
+type flightRecorder struct {
+	options flightRecorderOptions
+
+	mu      sync.Mutex
+	buffers map[any]*list.Element
+	// lru holds the buffers from the most recently used
+	lru list.List
+}
+
+// flightGlobalKey is the key of the buffer used when the records are not separated
+type flightGlobalKey struct{}
+
+// flightGoroutineKey is the key of per-goroutine buffer
+type flightGoroutineKey uint64
+
+func (f *flightRecorder) key(ctx context.Context) any {
+	if f.options.contextKey != nil && ctx != nil {
+		if value := ctx.Value(f.options.contextKey); value != nil {
+			return value
+		}
+	}
+	if f.options.perGoroutine {
+		return flightGoroutineKey(goroutineID())
+	}
+	return flightGlobalKey{}
+}
+
+// push stores the encoded record, it must be called with f.mu held
+func (f *flightRecorder) push(key any, level slog.Level, line []byte) {
+	var ring *flightRing
+	if elem, ok := f.buffers[key]; ok {
+		f.lru.MoveToFront(elem)
+		ring = elem.Value.(*flightRing)
+	} else {
+		if len(f.buffers) >= f.options.maxBuffers {
+			f.remove(f.lru.Back().Value.(*flightRing).key)
+		}
+		ring = &flightRing{
+			key:    key,
+			lines:  make([][]byte, f.options.size),
+			levels: make([]slog.Level, f.options.size),
+		}
+		f.buffers[key] = f.lru.PushFront(ring)
+	}
+	ring.push(level, line)
+}
+
+// remove discards the buffer of given key and returns it, it must be called with f.mu held
+func (f *flightRecorder) remove(key any) *flightRing {
+	elem, ok := f.buffers[key]
+	if !ok {
+		return nil
+	}
+	delete(f.buffers, key)
+	return f.lru.Remove(elem).(*flightRing)
+}
+
+// FlightRecorderHandler is [Handler] wrapper which keeps the last N records below the level
+// of the next handler in a ring buffer. When a record at the trigger level or above arrives, the buffered
+// records are logged before it with "log.flight_recorder": true, so the detailed records are logged only
+// when something failed.
+//
+// The records are encoded when buffered, so the buffer holds only the log lines. The records may be kept
+// in separate buffers per context key ([WithFlightRecorderContextKey]) or per goroutine
+// ([WithFlightRecorderPerGoroutine]), otherwise single buffer is used. At most max buffers × size
+// lines are held ([WithFlightRecorderMaxBuffers], [WithFlightRecorderSize]), by default 1024 × 100.
+type FlightRecorderHandler struct {
+	next     *Handler
+	recorder *flightRecorder
+}
+
+// NewFlightRecorderHandler creates a new [FlightRecorderHandler] passing the records to next.
+func NewFlightRecorderHandler(next *Handler, options ...FlightRecorderOption) *FlightRecorderHandler {
+	f := &flightRecorder{
+		options: flightRecorderOptions{
+			size:       100,
+			level:      slog.LevelDebug,
+			trigger:    slog.LevelError,
+			maxBuffers: 1024,
+		},
+		buffers: make(map[any]*list.Element),
+	}
+	for _, option := range options {
+		option(&f.options)
+	}
+
+	return &FlightRecorderHandler{
+		next:     next,
+		recorder: f,
+	}
+}
+
+// Reset discards the buffer used for ctx, e.g. when the request finished without an error.
+func (h *FlightRecorderHandler) Reset(ctx context.Context) {
+	f := h.recorder
+	key := f.key(ctx)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.remove(key)
+}
+
+// Enabled reports whether the next handler handles records at given level
+// or whether the records are buffered.
+func (h *FlightRecorderHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.recorder.options.level || h.next.Enabled(ctx, level)
+}
+
+// Handle passes the record to the next handler, or buffers it if it is below the level
+// of the next handler.
+func (h *FlightRecorderHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handleWithAttrs(ctx, record, nil)
+}
+
+func (h *FlightRecorderHandler) handleWithAttrs(ctx context.Context, record slog.Record, extra []slog.Attr) error {
+	f := h.recorder
+	enabled := h.next.Enabled(ctx, record.Level)
+	if !enabled && record.Level < f.options.level {
+		return nil
+	}
+	key := f.key(ctx)
+
+	if !enabled {
+		// do not modify the slice of the caller
+		extra = append(extra[:len(extra):len(extra)], slog.Bool("log.flight_recorder", true))
+	}
+
+	handleCtx := h.next.getHandleCtx()
+	attrs := h.next.appendAttrs(handleCtx, ctx, record, extra)
+	output := h.next.appendRecord(handleCtx.outputBuffer[:0], record, attrs)
+
+	var err error
+	switch {
+	case !enabled:
+		f.mu.Lock()
+		f.push(key, record.Level, output)
+		f.mu.Unlock()
+
+	case record.Level >= f.options.trigger:
+		err = h.flush(key)
+		if writeErr := h.next.write(record.Level, output); writeErr != nil {
+			err = writeErr
+		}
+
+	default:
+		err = h.next.write(record.Level, output)
+	}
+
+	h.next.putHandleCtx(handleCtx, output, attrs)
+	return err
+}
+
+// flush writes the buffered records to the next handler
+func (h *FlightRecorderHandler) flush(key any) error {
+	f := h.recorder
+	f.mu.Lock()
+	ring := f.remove(key)
+	f.mu.Unlock()
+	if ring == nil {
+		return nil
+	}
+
+	var err error
+	start := ring.next - ring.count + len(ring.lines)
+	for i := range ring.count {
+		j := (start + i) % len(ring.lines)
+		if writeErr := h.next.write(ring.levels[j], ring.lines[j]); writeErr != nil {
+			err = writeErr
+		}
+	}
+	return err
+}
+
+// WithAttrs creates new [FlightRecorderHandler] sharing the buffers with h.
+func (h *FlightRecorderHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &FlightRecorderHandler{
+		next:     h.next.WithAttrs(attrs).(*Handler),
+		recorder: h.recorder,
+	}
+}
+
+// WithGroup creates new [FlightRecorderHandler] sharing the buffers with h.
+func (h *FlightRecorderHandler) WithGroup(name string) slog.Handler {
+	return &FlightRecorderHandler{
+		next:     h.next.WithGroup(name).(*Handler),
+		recorder: h.recorder,
+	}
+}
+
+// goroutineID parses the ID of the current goroutine from its stack trace
+func goroutineID() uint64 {
+	var buf [64]byte
+	stack := buf[:runtime.Stack(buf[:], false)]
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	if i := bytes.IndexByte(stack, ' '); i >= 0 {
+		stack = stack[:i]
+	}
+	id, _ := strconv.ParseUint(string(stack), 10, 64)
+	return id
+}
@@ -0,0 +1,115 @@
+package ecslog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+func TestFlightRecorderHandler(t *testing.T) {
+	buff := &bytes.Buffer{}
+	h := NewFlightRecorderHandler(NewHandler(buff, WithTimestamp(false)), WithFlightRecorderSize(2))
+	logger := slog.New(h)
+
+	logger.Debug("first")
+	logger.Debug("second", slog.String("log.logger", "db"))
+	logger.Info("info")
+	logger.Debug("third")
+	logger.Error("failed")
+	logger.Error("failed again")
+
+	expected := []map[string]interface{}{
+		{"log": val{"level": "INFO"}, "message": "info"},
+		{"log": val{"level": "DEBUG", "logger": "db", "flight_recorder": true}, "message": "second"},
+		{"log": val{"level": "DEBUG", "flight_recorder": true}, "message": "third"},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+		{"log": val{"level": "ERROR"}, "message": "failed again"},
+	}
+	if output := unmarshalLogs(t, buff); !reflect.DeepEqual(output, expected) {
+		t.Errorf("mismatched output\nEXP: %v\nGOT: %v", expected, output)
+	}
+}
+
+type flightRecorderTestKey struct{}
+
+func TestFlightRecorderHandler_ContextKey(t *testing.T) {
+	buff := &bytes.Buffer{}
+	h := NewFlightRecorderHandler(NewHandler(buff, WithTimestamp(false)),
+		WithFlightRecorderContextKey(flightRecorderTestKey{}))
+	logger := slog.New(h)
+
+	first := context.WithValue(context.Background(), flightRecorderTestKey{}, "first")
+	second := context.WithValue(context.Background(), flightRecorderTestKey{}, "second")
+	third := context.WithValue(context.Background(), flightRecorderTestKey{}, "third")
+
+	logger.DebugContext(first, "first")
+	logger.DebugContext(second, "second")
+	logger.DebugContext(third, "third")
+	h.Reset(third)
+	logger.ErrorContext(second, "failed")
+	logger.ErrorContext(third, "failed")
+
+	expected := []map[string]interface{}{
+		{"log": val{"level": "DEBUG", "flight_recorder": true}, "message": "second"},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+	}
+	if output := unmarshalLogs(t, buff); !reflect.DeepEqual(output, expected) {
+		t.Errorf("mismatched output\nEXP: %v\nGOT: %v", expected, output)
+	}
+}
+
+func TestFlightRecorderHandler_PerGoroutine(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := slog.New(NewFlightRecorderHandler(NewHandler(buff, WithTimestamp(false)),
+		WithFlightRecorderPerGoroutine(true)))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		logger.Debug("other goroutine")
+	}()
+	<-done
+	logger.Debug("this goroutine")
+	logger.Error("failed")
+
+	expected := []map[string]interface{}{
+		{"log": val{"level": "DEBUG", "flight_recorder": true}, "message": "this goroutine"},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+	}
+	if output := unmarshalLogs(t, buff); !reflect.DeepEqual(output, expected) {
+		t.Errorf("mismatched output\nEXP: %v\nGOT: %v", expected, output)
+	}
+}
+
+func TestFlightRecorderHandler_MaxBuffers(t *testing.T) {
+	buff := &bytes.Buffer{}
+	h := NewFlightRecorderHandler(NewHandler(buff, WithTimestamp(false)),
+		WithFlightRecorderContextKey(flightRecorderTestKey{}),
+		WithFlightRecorderMaxBuffers(2))
+	logger := slog.New(h)
+
+	first := context.WithValue(context.Background(), flightRecorderTestKey{}, "first")
+	second := context.WithValue(context.Background(), flightRecorderTestKey{}, "second")
+	third := context.WithValue(context.Background(), flightRecorderTestKey{}, "third")
+
+	logger.DebugContext(first, "first")
+	logger.DebugContext(second, "second")
+	logger.DebugContext(first, "first again")
+	// the least recently used buffer is discarded
+	logger.DebugContext(third, "third")
+	logger.ErrorContext(first, "failed")
+	logger.ErrorContext(second, "failed")
+
+	expected := []map[string]interface{}{
+		{"log": val{"level": "DEBUG", "flight_recorder": true}, "message": "first"},
+		{"log": val{"level": "DEBUG", "flight_recorder": true}, "message": "first again"},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+	}
+	if output := unmarshalLogs(t, buff); !reflect.DeepEqual(output, expected) {
+		t.Errorf("mismatched output\nEXP: %v\nGOT: %v", expected, output)
+	}
+}
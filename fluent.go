@@ -0,0 +1,408 @@
+package ecslog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oidq/ecslog/internal/msgpack"
+)
+
+// FluentMode selects the Fluent Forward protocol event mode used by [FluentWriter].
+type FluentMode int
+
+const (
+	// FluentPackedForward sends all buffered records with the same tag as a single
+	// message `[tag, entries, option]`.
+	FluentPackedForward FluentMode = iota
+	// FluentMessage sends each record as a separate message `[tag, time, record, option]`.
+	FluentMessage
+)
+
+type fluentOptions struct {
+	mode          FluentMode
+	tag           string
+	ack           bool
+	timeout       time.Duration
+	batchSize     int
+	bufferSize    int
+	flushInterval time.Duration
+}
+
+// FluentOption configures [FluentWriter].
+type FluentOption func(*fluentOptions)
+
+// WithFluentMode sets the event mode. Default value is [FluentPackedForward].
+func WithFluentMode(mode FluentMode) FluentOption {
+	return func(o *fluentOptions) {
+		o.mode = mode
+	}
+}
+
+// WithFluentTag sets the tag of records. When the record contains "event.dataset",
+// it is appended to the tag (e.g. "ecslog.audit"). Default value is "ecslog".
+func WithFluentTag(tag string) FluentOption {
+	return func(o *fluentOptions) {
+		o.tag = tag
+	}
+}
+
+// WithFluentAck option can be used to require acknowledgement of each message by the server.
+func WithFluentAck(ack bool) FluentOption {
+	return func(o *fluentOptions) {
+		o.ack = ack
+	}
+}
+
+// WithFluentTimeout sets the timeout of dialing, writing and waiting for acknowledgement.
+// Default value is 5s.
+func WithFluentTimeout(timeout time.Duration) FluentOption {
+	return func(o *fluentOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithFluentBatch sets the size in bytes of buffered records which triggers the flush
+// and the maximum time records are buffered. Default values are 64KiB and 1s.
+func WithFluentBatch(size int, interval time.Duration) FluentOption {
+	return func(o *fluentOptions) {
+		o.batchSize = size
+		o.flushInterval = interval
+	}
+}
+
+// WithFluentBufferSize sets the maximum size in bytes of records buffered while the server
+// is unreachable. Records exceeding the size are dropped. Default value is 8MiB.
+func WithFluentBufferSize(size int) FluentOption {
+	return func(o *fluentOptions) {
+		o.bufferSize = size
+	}
+}
+
+type fluentEntry struct {
+	tag string
+	// data contains encoded `time, record` pair
+	data []byte
+}
+
+// FluentWriter is an [io.Writer] which sends lines produced by [Handler] to Fluentd or Fluent Bit
+// using the Fluent Forward protocol.
+//
+// The record is sent as the same nested structure as produced by [Handler], the time of the
+// event is taken from "@timestamp".
+//
+// Records are buffered and sent when the buffer exceeds the batch size or when the flush interval
+// elapses. When the server is unreachable, the records are kept in the buffer up to its size
+// and the connection is re-established with the next flush.
+type FluentWriter struct {
+	network string
+	addr    string
+	options fluentOptions
+
+	mu          sync.Mutex
+	pending     []fluentEntry
+	pendingSize int
+	closed      bool
+
+	dropped atomic.Uint64
+
+	// sendMu guards the connection and serializes flushes
+	sendMu sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	buffer []byte
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewFluentWriter creates a new [FluentWriter] sending records to given address (e.g. "tcp", "localhost:24224"
+// or "unix", "/var/run/fluent.sock"). The connection is established with the first flush.
+// The writer should be closed by [FluentWriter.Close].
+func NewFluentWriter(network, addr string, options ...FluentOption) *FluentWriter {
+	opts := fluentOptions{
+		tag:           "ecslog",
+		timeout:       5 * time.Second,
+		batchSize:     64 << 10,
+		bufferSize:    8 << 20,
+		flushInterval: time.Second,
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	w := &FluentWriter{
+		network: network,
+		addr:    addr,
+		options: opts,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write buffers each line of p as a separate record.
+func (w *FluentWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	for line := range bytes.Lines(p) {
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if len(line) == 0 {
+			continue
+		}
+
+		entry, err := w.entry(line)
+		if err != nil {
+			return 0, err
+		}
+		if w.pendingSize+len(entry.data) > w.options.bufferSize {
+			w.dropped.Add(1)
+			continue
+		}
+		w.pending = append(w.pending, entry)
+		w.pendingSize += len(entry.data)
+	}
+
+	if w.pendingSize >= w.options.batchSize {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Dropped returns the number of records dropped due to the full buffer.
+func (w *FluentWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Flush sends all buffered records. Records which could not be sent are kept in the buffer.
+func (w *FluentWriter) Flush(ctx context.Context) error {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+
+	w.mu.Lock()
+	entries := w.pending
+	w.pending = nil
+	w.pendingSize = 0
+	w.mu.Unlock()
+
+	if w.options.mode == FluentPackedForward {
+		// group the records with the same tag, preserving their order
+		slices.SortStableFunc(entries, func(a, b fluentEntry) int {
+			return strings.Compare(a.tag, b.tag)
+		})
+	}
+
+	var err error
+	for len(entries) > 0 && err == nil {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		n := 1
+		if w.options.mode == FluentPackedForward {
+			n = sameTagEntries(entries)
+		}
+		if err = w.send(entries[:n]); err == nil {
+			entries = entries[n:]
+		}
+	}
+
+	if len(entries) > 0 {
+		// keep the unsent records in front of the ones written in the meantime
+		w.mu.Lock()
+		size := 0
+		for _, entry := range entries {
+			size += len(entry.data)
+		}
+		w.pending = append(entries, w.pending...)
+		w.pendingSize += size
+		w.mu.Unlock()
+		return retainedError{err: err}
+	}
+	return err
+}
+
+// Close sends all buffered records and closes the connection.
+func (w *FluentWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.stop)
+	<-w.done
+
+	err := w.Flush(ctx)
+
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+	if w.conn != nil {
+		err = errors.Join(err, w.conn.Close())
+		w.conn = nil
+	}
+	return err
+}
+
+func (w *FluentWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.options.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.wake:
+		case <-w.stop:
+			return
+		}
+		// unsent records are kept for the next flush
+		_ = w.Flush(context.Background())
+	}
+}
+
+func (w *FluentWriter) entry(line []byte) (fluentEntry, error) {
+	record, err := decodeRecord(line)
+	if err != nil {
+		return fluentEntry{}, fmt.Errorf("ecslog: invalid record: %w", err)
+	}
+
+	t0, err := time.Parse(time.RFC3339Nano, lookupString(record, "@timestamp"))
+	if err != nil {
+		t0 = time.Now()
+	}
+
+	tag := w.options.tag
+	if dataset := lookupString(record, "event.dataset"); dataset != "" {
+		tag += "." + dataset
+	}
+
+	data := msgpack.AppendEventTime(nil, t0)
+	data = msgpack.AppendValue(data, record)
+	return fluentEntry{tag: tag, data: data}, nil
+}
+
+// sameTagEntries returns number of leading entries with the same tag
+func sameTagEntries(entries []fluentEntry) int {
+	for i := range entries {
+		if entries[i].tag != entries[0].tag {
+			return i
+		}
+	}
+	return len(entries)
+}
+
+// send sends entries with the same tag as a single message, it must be called with w.sendMu held
+func (w *FluentWriter) send(entries []fluentEntry) error {
+	var chunk string
+	if w.options.ack {
+		var id [16]byte
+		_, _ = rand.Read(id[:])
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+	}
+
+	msg := w.buffer[:0]
+	if w.options.mode == FluentPackedForward {
+		size := 0
+		for _, entry := range entries {
+			size += len(entry.data) + 1
+		}
+
+		msg = msgpack.AppendArrayHeader(msg, 3)
+		msg = msgpack.AppendString(msg, entries[0].tag)
+		msg = msgpack.AppendBinHeader(msg, size)
+		for _, entry := range entries {
+			msg = msgpack.AppendArrayHeader(msg, 2)
+			msg = append(msg, entry.data...)
+		}
+		msg = appendFluentOption(msg, len(entries), chunk)
+	} else {
+		msg = msgpack.AppendArrayHeader(msg, 4)
+		msg = msgpack.AppendString(msg, entries[0].tag)
+		msg = append(msg, entries[0].data...)
+		msg = appendFluentOption(msg, 1, chunk)
+	}
+	w.buffer = msg
+
+	// retry once with a new connection, the server may have closed the previous one
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if err = w.sendMessage(msg, chunk); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func appendFluentOption(msg []byte, size int, chunk string) []byte {
+	if chunk == "" {
+		msg = msgpack.AppendMapHeader(msg, 1)
+	} else {
+		msg = msgpack.AppendMapHeader(msg, 2)
+		msg = msgpack.AppendString(msg, "chunk")
+		msg = msgpack.AppendString(msg, chunk)
+	}
+	msg = msgpack.AppendString(msg, "size")
+	return msgpack.AppendInt(msg, int64(size))
+}
+
+func (w *FluentWriter) sendMessage(msg []byte, chunk string) error {
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.network, w.addr, w.options.timeout)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+		w.reader = bufio.NewReader(conn)
+	}
+
+	err := w.exchange(msg, chunk)
+	if err != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+func (w *FluentWriter) exchange(msg []byte, chunk string) error {
+	_ = w.conn.SetDeadline(time.Now().Add(w.options.timeout))
+	if _, err := w.conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	resp, err := msgpack.Decode(w.reader)
+	if err != nil {
+		return err
+	}
+	if ack, _ := resp.(map[string]any); ack == nil || ack["ack"] != chunk {
+		return errors.New("ecslog: invalid fluent acknowledgement")
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package ecslog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/oidq/ecslog/internal/msgpack"
+)
+
+type fluentEvent struct {
+	tag    string
+	time   time.Time
+	record any
+}
+
+// fakeFluent accepts Fluent Forward connections and sends decoded events to the channel,
+// it closes the first connection after the first message when closeFirst is set
+type fakeFluent struct {
+	listener   net.Listener
+	events     chan fluentEvent
+	closeFirst bool
+}
+
+func newFakeFluent(t *testing.T, closeFirst bool) *fakeFluent {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeFluent{listener: listener, events: make(chan fluentEvent, 100), closeFirst: closeFirst}
+	go f.serve(t)
+	t.Cleanup(func() { _ = listener.Close() })
+	return f
+}
+
+func (f *fakeFluent) serve(t *testing.T) {
+	for first := true; ; first = false {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.handle(t, conn, first && f.closeFirst)
+	}
+}
+
+func (f *fakeFluent) handle(t *testing.T, conn net.Conn, closeEarly bool) {
+	defer func() { _ = conn.Close() }()
+
+	r := bufio.NewReader(conn)
+	for {
+		v, err := msgpack.Decode(r)
+		if err != nil {
+			return
+		}
+		if closeEarly {
+			return
+		}
+
+		msg := v.([]any)
+		tag := msg[0].(string)
+		option := msg[len(msg)-1].(map[string]any)
+
+		if entries, ok := msg[1].([]byte); ok {
+			entriesReader := bufio.NewReader(bytes.NewReader(entries))
+			for {
+				entry, err := msgpack.Decode(entriesReader)
+				if err != nil {
+					break
+				}
+				f.events <- newFluentEvent(t, tag, entry.([]any)[0], entry.([]any)[1])
+			}
+		} else {
+			f.events <- newFluentEvent(t, tag, msg[1], msg[2])
+		}
+
+		if chunk, ok := option["chunk"]; ok {
+			resp := msgpack.AppendMapHeader(nil, 1)
+			resp = msgpack.AppendString(resp, "ack")
+			resp = msgpack.AppendString(resp, chunk.(string))
+			_, _ = conn.Write(resp)
+		}
+	}
+}
+
+func newFluentEvent(t *testing.T, tag string, eventTime, record any) fluentEvent {
+	ext, ok := eventTime.(msgpack.Ext)
+	if !ok || ext.Type != msgpack.EventTimeExt || len(ext.Data) != 8 {
+		t.Errorf("invalid event time: %#v", eventTime)
+		return fluentEvent{tag: tag, record: record}
+	}
+	sec := int64(ext.Data[0])<<24 | int64(ext.Data[1])<<16 | int64(ext.Data[2])<<8 | int64(ext.Data[3])
+	nsec := int64(ext.Data[4])<<24 | int64(ext.Data[5])<<16 | int64(ext.Data[6])<<8 | int64(ext.Data[7])
+	return fluentEvent{tag: tag, time: time.Unix(sec, nsec), record: record}
+}
+
+func (f *fakeFluent) receive(t *testing.T, n int) []fluentEvent {
+	var events []fluentEvent
+	for i := 0; i < n; i++ {
+		select {
+		case event := <-f.events:
+			events = append(events, event)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d events, got %d", n, len(events))
+		}
+	}
+	return events
+}
+
+var fluentModeTestData = []struct {
+	name string
+	mode FluentMode
+}{
+	{name: "PackedForward", mode: FluentPackedForward},
+	{name: "Message", mode: FluentMessage},
+}
+
+func TestFluentWriter(t *testing.T) {
+	for _, data := range fluentModeTestData {
+		t.Run(data.name, func(t *testing.T) {
+			server := newFakeFluent(t, false)
+			w := NewFluentWriter("tcp", server.listener.Addr().String(),
+				WithFluentMode(data.mode),
+				WithFluentAck(true),
+			)
+
+			ts := time.Date(2026, 1, 11, 17, 0, 42, 426480000, time.UTC)
+			ecs := slog.New(NewHandler(w))
+			ecs.LogAttrs(context.Background(), slog.LevelInfo, "first", slog.String("event.dataset", "audit"))
+			r := slog.NewRecord(ts, slog.LevelWarn, "second", 0)
+			r.AddAttrs(slog.Int("http.response.status_code", 200))
+			_ = ecs.Handler().Handle(context.Background(), r)
+
+			if err := w.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			events := server.receive(t, 2)
+			if data.mode == FluentPackedForward {
+				// records are grouped by tag
+				events[0], events[1] = events[1], events[0]
+			}
+
+			if events[0].tag != "ecslog.audit" || events[1].tag != "ecslog" {
+				t.Errorf("unexpected tags: %s, %s", events[0].tag, events[1].tag)
+			}
+			if !events[1].time.Equal(ts) {
+				t.Errorf("unexpected time: %s", events[1].time)
+			}
+
+			expected := map[string]any{
+				"@timestamp": "2026-01-11T17:00:42.42648Z",
+				"message":    "second",
+				"log":        map[string]any{"level": "WARN"},
+				"http": map[string]any{
+					"response": map[string]any{"status_code": uint64(200)},
+				},
+			}
+			if !reflect.DeepEqual(events[1].record, expected) {
+				t.Errorf("mismatched record\nEXP: %#v\nGOT: %#v", expected, events[1].record)
+			}
+		})
+	}
+}
+
+func TestFluentWriter_Reconnect(t *testing.T) {
+	server := newFakeFluent(t, true)
+	w := NewFluentWriter("tcp", server.listener.Addr().String(), WithFluentAck(true))
+	defer func() { _ = w.Close(context.Background()) }()
+
+	ecs := slog.New(NewHandler(w))
+	ecs.Info("first")
+	ecs.Info("second")
+
+	if err := w.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	events := server.receive(t, 2)
+	for i, msg := range []string{"first", "second"} {
+		if events[i].record.(map[string]any)["message"] != msg {
+			t.Errorf("unexpected record: %#v", events[i].record)
+		}
+	}
+}
+
+func TestFluentWriter_Buffering(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	w := NewFluentWriter("tcp", addr, WithFluentBufferSize(200))
+	defer func() { _ = w.Close(context.Background()) }()
+
+	ecs := slog.New(NewHandler(w))
+	for i := 0; i < 5; i++ {
+		ecs.Info("Hello World")
+	}
+
+	if err := w.Flush(context.Background()); err == nil {
+		t.Error("flush to unreachable server should fail")
+	}
+	if w.Dropped() == 0 || w.Dropped() == 5 {
+		t.Errorf("expected some records to be dropped, got %d", w.Dropped())
+	}
+}
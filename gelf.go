@@ -0,0 +1,331 @@
+package ecslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GELFCompression selects compression of GELF messages sent over UDP.
+type GELFCompression int
+
+const (
+	// GELFGzip compresses messages with gzip.
+	GELFGzip GELFCompression = iota
+	// GELFZlib compresses messages with zlib.
+	GELFZlib
+	// GELFNoCompression sends messages uncompressed.
+	GELFNoCompression
+)
+
+// gelfMaxChunks is the maximum number of chunks of a single message allowed by GELF
+const gelfMaxChunks = 128
+
+// gelfChunkHeaderSize is the size of chunk magic bytes, message ID and sequence info
+const gelfChunkHeaderSize = 12
+
+type gelfOptions struct {
+	hostname    string
+	compression GELFCompression
+	chunkSize   int
+	timeout     time.Duration
+}
+
+// GELFOption configures [GELFWriter].
+type GELFOption func(*gelfOptions)
+
+// WithGELFHostname sets the host used when the record does not contain "host.hostname".
+// Default value is [os.Hostname].
+func WithGELFHostname(hostname string) GELFOption {
+	return func(o *gelfOptions) {
+		o.hostname = hostname
+	}
+}
+
+// WithGELFCompression sets the compression of messages sent over UDP. Default value is [GELFGzip].
+// Messages sent over TCP are never compressed.
+func WithGELFCompression(compression GELFCompression) GELFOption {
+	return func(o *gelfOptions) {
+		o.compression = compression
+	}
+}
+
+// WithGELFChunkSize sets the maximum size of UDP datagram. Larger messages are chunked.
+// Default value is 1420.
+func WithGELFChunkSize(size int) GELFOption {
+	return func(o *gelfOptions) {
+		o.chunkSize = max(size, gelfChunkHeaderSize+1)
+	}
+}
+
+// WithGELFTimeout sets the timeout of dialing and writing to the connection.
+// Default value is 5s.
+func WithGELFTimeout(timeout time.Duration) GELFOption {
+	return func(o *gelfOptions) {
+		o.timeout = timeout
+	}
+}
+
+// GELFWriter is an [io.Writer] which translates lines produced by [Handler] to GELF 1.1 messages
+// and sends them to Graylog.
+//
+// "message" is used as "short_message", "log.level" is mapped to syslog "level", "host.hostname"
+// to "host" and "@timestamp" to "timestamp". All other fields become additional fields with
+// underscores instead of dots (e.g. "event.action" becomes "_event_action").
+//
+// Supported networks are "udp", where the messages are compressed and chunked, and "tcp", where
+// the messages are delimited by null byte. When writing to TCP fails, the connection is
+// re-established and the message is sent once more.
+type GELFWriter struct {
+	network string
+	addr    string
+	options gelfOptions
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+	buffer []byte
+	packet []byte
+	zipped bytes.Buffer
+}
+
+// NewGELFWriter creates a new [GELFWriter] and connects to given address.
+func NewGELFWriter(network, addr string, options ...GELFOption) (*GELFWriter, error) {
+	opts := gelfOptions{
+		chunkSize: 1420,
+		timeout:   5 * time.Second,
+	}
+	opts.hostname, _ = os.Hostname()
+	for _, option := range options {
+		option(&opts)
+	}
+
+	w := &GELFWriter{
+		network: network,
+		addr:    addr,
+		options: opts,
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write sends each line of p as a separate GELF message. It fails with [ErrClosed]
+// after the writer has been closed.
+func (w *GELFWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	for line := range bytes.Lines(p) {
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if len(line) == 0 {
+			continue
+		}
+
+		record, err := decodeRecord(line)
+		if err != nil {
+			return 0, err
+		}
+		w.buffer = appendGELF(w.buffer[:0], record, w.options.hostname)
+
+		if w.isStream() {
+			w.buffer = append(w.buffer, 0)
+			err = w.sendStream(w.buffer)
+		} else {
+			err = w.sendDatagrams(w.buffer)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close closes the connection. Further writes fail with [ErrClosed].
+func (w *GELFWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *GELFWriter) isStream() bool {
+	return !strings.HasPrefix(w.network, "udp")
+}
+
+func (w *GELFWriter) connect() error {
+	conn, err := net.DialTimeout(w.network, w.addr, w.options.timeout)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// sendStream must be called with w.mu held, the connection is re-established
+// only when it was lost by previous failed write
+func (w *GELFWriter) sendStream(msg []byte) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				continue
+			}
+		}
+
+		_ = w.conn.SetWriteDeadline(time.Now().Add(w.options.timeout))
+		if _, err = w.conn.Write(msg); err == nil {
+			return nil
+		}
+
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+// sendDatagrams must be called with w.mu held
+func (w *GELFWriter) sendDatagrams(msg []byte) error {
+	if w.options.compression != GELFNoCompression {
+		var err error
+		if msg, err = w.compress(msg); err != nil {
+			return err
+		}
+	}
+
+	_ = w.conn.SetWriteDeadline(time.Now().Add(w.options.timeout))
+	if len(msg) <= w.options.chunkSize {
+		_, err := w.conn.Write(msg)
+		return err
+	}
+
+	dataSize := w.options.chunkSize - gelfChunkHeaderSize
+	count := (len(msg) + dataSize - 1) / dataSize
+	if count > gelfMaxChunks {
+		return errors.New("ecslog: GELF message exceeds maximum number of chunks")
+	}
+
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	for seq := 0; seq < count; seq++ {
+		chunk := msg[seq*dataSize : min((seq+1)*dataSize, len(msg))]
+
+		w.packet = append(w.packet[:0], 0x1e, 0x0f)
+		w.packet = append(w.packet, id[:]...)
+		w.packet = append(w.packet, byte(seq), byte(count))
+		w.packet = append(w.packet, chunk...)
+		if _, err := w.conn.Write(w.packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *GELFWriter) compress(msg []byte) ([]byte, error) {
+	w.zipped.Reset()
+
+	var zw io.WriteCloser
+	if w.options.compression == GELFZlib {
+		zw = zlib.NewWriter(&w.zipped)
+	} else {
+		zw = gzip.NewWriter(&w.zipped)
+	}
+	if _, err := zw.Write(msg); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return w.zipped.Bytes(), nil
+}
+
+// appendGELF encodes decoded record as GELF 1.1 message
+func appendGELF(output []byte, record map[string]any, hostname string) []byte {
+	output = append(output, `{"version":"1.1","host":`...)
+	if recordHost := lookupString(record, "host.hostname"); recordHost != "" {
+		hostname = recordHost
+	}
+	output = appendJsonString(output, hostname)
+
+	output = append(output, `,"short_message":`...)
+	msg, _ := record["message"].(string)
+	if msg == "" {
+		// short_message is mandatory
+		msg = "-"
+	}
+	output = appendJsonString(output, msg)
+
+	if t0, err := time.Parse(time.RFC3339Nano, lookupString(record, "@timestamp")); err == nil {
+		output = append(output, `,"timestamp":`...)
+		output = strconv.AppendInt(output, t0.Unix(), 10)
+		output = append(output, '.')
+		output = appendPadded(output, t0.Nanosecond()/1000, 6)
+	}
+
+	output = append(output, `,"level":`...)
+	output = strconv.AppendInt(output, int64(syslogSeverity(parseLevel(lookupString(record, "log.level")))), 10)
+
+	flattenRecord(record, "", func(key string, value any) {
+		switch key {
+		case "message", "@timestamp", "log.level", "host.hostname":
+			return
+		case "id":
+			// "_id" is reserved by GELF
+			return
+		}
+		if value == nil {
+			return
+		}
+
+		output = append(output, ',')
+		output = appendJsonString(output, "_"+strings.ReplaceAll(key, ".", "_"))
+		output = append(output, ':')
+
+		// GELF allows only strings and numbers
+		switch value := value.(type) {
+		case json.Number:
+			output = append(output, value...)
+		case string:
+			output = appendJsonString(output, value)
+		case bool:
+			output = appendJsonString(output, strconv.FormatBool(value))
+		default:
+			encoded, _ := json.Marshal(value)
+			output = appendJsonString(output, string(encoded))
+		}
+	})
+
+	return append(output, '}')
+}
+
+func appendPadded(output []byte, value, width int) []byte {
+	formatted := strconv.Itoa(value)
+	for i := len(formatted); i < width; i++ {
+		output = append(output, '0')
+	}
+	return append(output, formatted...)
+}
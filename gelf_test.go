@@ -0,0 +1,170 @@
+package ecslog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGELFWriter_ChunkedUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	w, err := NewGELFWriter("udp", conn.LocalAddr().String(),
+		WithGELFChunkSize(64),
+		WithGELFHostname("default-host"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = w.Close() }()
+
+	ts := time.Date(2026, 1, 11, 17, 0, 42, 426480000, time.UTC)
+	r := slog.NewRecord(ts, slog.LevelError, "Hello World", 0)
+	r.AddAttrs(
+		slog.String("event.action", "test"),
+		slog.Bool("event.success", false),
+		slog.Int("http.response.status_code", 500),
+		slog.Any("tags", []string{"a", "b"}),
+	)
+	if err := NewHandler(w).Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+
+	// reassemble the chunks, they are sent in order over loopback
+	var payload []byte
+	buff := make([]byte, 128)
+	for seq, count := 0, 1; seq < count; seq++ {
+		n, _, err := conn.ReadFrom(buff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk := buff[:n]
+		if n > 64 || chunk[0] != 0x1e || chunk[1] != 0x0f || int(chunk[10]) != seq {
+			t.Fatalf("invalid chunk %d: %x", seq, chunk)
+		}
+		count = int(chunk[11])
+		payload = append(payload, chunk[12:]...)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output map[string]any
+	if err := json.Unmarshal(msg, &output); err != nil {
+		t.Fatalf("invalid message: %s", msg)
+	}
+	expected := map[string]any{
+		"version":                    "1.1",
+		"host":                       "default-host",
+		"short_message":              "Hello World",
+		"timestamp":                  1768150842.42648,
+		"level":                      float64(3),
+		"_event_action":              "test",
+		"_event_success":             "false",
+		"_http_response_status_code": float64(500),
+		"_tags":                      `["a","b"]`,
+	}
+	if !reflect.DeepEqual(output, expected) {
+		t.Errorf("mismatched message\nEXP: %#v\nGOT: %#v", expected, output)
+	}
+}
+
+func TestGELFWriter_TCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	w, err := NewGELFWriter("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = w.Close() }()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	ecs := slog.New(NewHandler(w, WithTimestamp(false)))
+	ecs.Info("first", slog.String("host.hostname", "ecs-host"))
+	ecs.Warn("second")
+
+	r := bufio.NewReader(conn)
+	for _, expected := range []map[string]any{
+		{"version": "1.1", "host": "ecs-host", "short_message": "first", "level": float64(6)},
+		{"version": "1.1", "host": w.options.hostname, "short_message": "second", "level": float64(4)},
+	} {
+		msg, err := r.ReadBytes(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var output map[string]any
+		if err := json.Unmarshal(msg[:len(msg)-1], &output); err != nil {
+			t.Fatalf("invalid message: %s", msg)
+		}
+		if !reflect.DeepEqual(output, expected) {
+			t.Errorf("mismatched message\nEXP: %#v\nGOT: %#v", expected, output)
+		}
+	}
+}
+
+func TestGELFWriter_Closed(t *testing.T) {
+	for _, network := range []string{"udp", "tcp"} {
+		t.Run(network, func(t *testing.T) {
+			var addr string
+			if network == "udp" {
+				conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer func() { _ = conn.Close() }()
+				addr = conn.LocalAddr().String()
+			} else {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer func() { _ = listener.Close() }()
+				addr = listener.Addr().String()
+			}
+
+			w, err := NewGELFWriter(network, addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("close failed: %s", err)
+			}
+
+			if _, err := w.Write([]byte(`{"message":"late"}` + "\n")); !errors.Is(err, ErrClosed) {
+				t.Errorf("write after close should fail, got %v", err)
+			}
+			if err := w.Close(); !errors.Is(err, ErrClosed) {
+				t.Errorf("second close should fail, got %v", err)
+			}
+		})
+	}
+}
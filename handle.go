@@ -11,6 +11,11 @@ import (
 type handleContext struct {
 	outputBuffer     []byte
 	attributesBuffer []slog.Attr
+
+	// formatted holds the values encoded by the scrubber for the output, the first
+	// formattedCount of them are used by the current record
+	formatted      []*preformattedValue
+	formattedCount int
 }
 
 const handleCtxMaxAttrsSize = 128
@@ -23,6 +28,16 @@ func newHandleContext() any {
 	}
 }
 
+// nextFormatted returns unused preformatted value, which is valid until the context is put back
+func (handleCtx *handleContext) nextFormatted() *preformattedValue {
+	if handleCtx.formattedCount == len(handleCtx.formatted) {
+		handleCtx.formatted = append(handleCtx.formatted, &preformattedValue{})
+	}
+	formatted := handleCtx.formatted[handleCtx.formattedCount]
+	handleCtx.formattedCount++
+	return formatted
+}
+
 func (h *Handler) getHandleCtx() *handleContext {
 	return h.handleContextPool.Get().(*handleContext)
 }
@@ -37,6 +52,14 @@ func (h *Handler) putHandleCtx(handleCtx *handleContext, outputBuff []byte, attr
 
 	handleCtx.outputBuffer = outputBuff
 	handleCtx.attributesBuffer = attrsBuff
+	for _, formatted := range handleCtx.formatted[:handleCtx.formattedCount] {
+		// do not retain the logged values
+		formatted.original = slog.Value{}
+		if cap(formatted.value) > handleCtxMaxBufferSize {
+			formatted.value = nil
+		}
+	}
+	handleCtx.formattedCount = 0
 	h.handleContextPool.Put(handleCtx)
 }
 
@@ -45,61 +68,126 @@ func (h *Handler) putHandleCtx(handleCtx *handleContext, outputBuff []byte, attr
 //
 // It is called by slog package.
 func (h *Handler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handleWithAttrs(ctx, record, nil)
+}
+
+// handleWithAttrs handles the record with extra top-level attributes, which are not
+// affected by h.attrPrefix
+func (h *Handler) handleWithAttrs(ctx context.Context, record slog.Record, extra []slog.Attr) error {
 	// prepare buffers for the handling
 	handleCtx := h.getHandleCtx()
-	output := handleCtx.outputBuffer[:0]
+
+	attrs := h.appendAttrs(handleCtx, ctx, record, extra)
+	output := h.appendRecord(handleCtx.outputBuffer[:0], record, attrs)
+	err := h.write(record.Level, output)
+
+	// return buffers for further use
+	h.putHandleCtx(handleCtx, output, attrs)
+
+	return err
+}
+
+// appendAttrs collects all attributes of the record sorted for resolveRecord to the attributes
+// buffer of handleCtx
+func (h *Handler) appendAttrs(handleCtx *handleContext, ctx context.Context, record slog.Record, extra []slog.Attr) []slog.Attr {
 	attrs := handleCtx.attributesBuffer[:0]
 
-	// prepopulate the attributes
+	// prepopulate the attributes, which precede the attributes from Handler
 	attrs = append(attrs, slog.String("log.level", record.Level.String()))
 	if h.options.addSource {
 		attrs = addSource(attrs, record)
 	}
+	head := len(attrs)
 
-	// insert attributes from Handler
-	for _, attr := range h.attributes {
-		attrs = append(attrs, attr...)
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs = h.appendRecordAttr(handleCtx, attrs, attr)
+		return true
+	})
+	attrs = append(attrs, extra...)
+	if h.options.debugSessions {
+		attrs = appendDebugSession(attrs, ctx)
 	}
 
-	// insert attributes from record with respect to h.attrPrefix
-	record.Attrs(func(attr slog.Attr) bool {
-		// per slog.Handler doc we should ignore empty attributes
-		if attr.Equal(slog.Attr{}) {
-			return true
-		}
+	if len(h.attributes) == 0 {
+		slices.SortStableFunc(attrs, isEarlierAttr)
+		return attrs
+	}
 
-		// per slog.Handler doc we should ignore empty groups
-		if attr.Value.Kind() == slog.KindGroup && len(attr.Value.Group()) == 0 {
-			return true
-		}
+	// attributes from Handler are already sorted, so only the attributes of the record are sorted
+	// and merged with them in place: the attributes of the record are moved to the end of the buffer,
+	// which is grown exactly by the number of the attributes from Handler, and the merge writes
+	// from the start, never overtaking the attributes it reads
+	slices.SortStableFunc(attrs[:head], isEarlierAttr)
+	slices.SortStableFunc(attrs[head:], isEarlierAttr)
+	var headBuf [4]slog.Attr
+	prepopulated := append(headBuf[:0], attrs[:head]...)
+	n, base := len(attrs), len(h.attributes)
+	attrs = slices.Grow(attrs, base)[:n+base]
+	copy(attrs[base+head:], attrs[head:n])
+	return mergeSortedAttrs(attrs[:0], prepopulated, h.attributes, attrs[base+head:])
+}
+
+// appendRecordAttr appends attribute of the record with respect to h.attrPrefix
+func (h *Handler) appendRecordAttr(handleCtx *handleContext, attrs []slog.Attr, attr slog.Attr) []slog.Attr {
+	// per slog.Handler doc we should ignore empty attributes
+	if attr.Equal(slog.Attr{}) {
+		return attrs
+	}
+
+	// per slog.Handler doc we should ignore empty groups
+	if attr.Value.Kind() == slog.KindGroup && len(attr.Value.Group()) == 0 {
+		return attrs
+	}
 
-		if h.attrPrefix != "" {
-			attr.Key = h.attrPrefix + attr.Key
-		} else if isIgnoredKey(attr.Key) {
-			return true // top level ignored key
+	// attributes with empty key or map values may expand to multiple attributes
+	if expanded, ok := expandAttr(attr, h.options.expandMaps); ok {
+		for _, expandedAttr := range expanded {
+			attrs = h.appendRecordAttr(handleCtx, attrs, expandedAttr)
 		}
-		attrs = append(attrs, attr)
-		return true
-	})
+		return attrs
+	}
 
-	slices.SortStableFunc(attrs, isEarlierAttr)
+	if h.attrPrefix != "" {
+		attr.Key = h.attrPrefix + attr.Key
+	} else if isIgnoredKey(attr.Key) {
+		return attrs // top level ignored key
+	}
+	if h.options.redactor != nil {
+		if attr, _ = h.options.redactor.redactAttr(attr.Key, attr); attr.Equal(slog.Attr{}) {
+			return attrs // removed by redaction
+		}
+	}
+	if h.options.scrubber != nil {
+		attr, _ = h.options.scrubber.scrubAttr(attr, handleCtx)
+	}
+	return append(attrs, attr)
+}
 
+// appendRecord resolves the record with sorted attributes to single log line
+func (h *Handler) appendRecord(output []byte, record slog.Record, sortedAttrs []slog.Attr) []byte {
 	var t0 time.Time
 	if !h.options.hideTimestamp {
 		t0 = record.Time
 	}
 
-	// resolve the record to single log line
-	output = resolveRecord(output, t0, record.Message, attrs)
-	output = append(output, '\n')
+	msg := record.Message
+	if h.options.scrubber != nil {
+		msg, _ = h.options.scrubber.scrub(msg)
+	}
+
+	output = resolveRecord(output, t0, msg, sortedAttrs)
+	return append(output, '\n')
+}
 
+func (h *Handler) write(level slog.Level, output []byte) error {
 	// from io.Write - "Write must not retain p",
 	// meaning we can reuse the buffer later
-	_, err := h.writer.Write(output)
-
-	// return buffers for further use
-	h.putHandleCtx(handleCtx, output, attrs)
-
+	var err error
+	if lw, ok := h.writer.(LevelWriter); ok {
+		_, err = lw.WriteLevel(level, output)
+	} else {
+		_, err = h.writer.Write(output)
+	}
 	return err
 }
 
@@ -18,29 +18,70 @@ type Handler struct {
 	handleContextPool *sync.Pool
 
 	attrPrefix string
-	attributes [][]slog.Attr
+	// attributes from WithAttrs sorted by isEarlierAttr without duplicate keys,
+	// so Handle merges only the attributes of the record with them
+	attributes []slog.Attr
+
+	// levelNode holds level of the logger from options.levelRegistry
+	levelNode *levelNode
+}
+
+// LevelWriter is an [io.Writer] which wants to know the level of the written record.
+// If the writer given to [NewHandler] implements this interface, WriteLevel is used instead of Write.
+//
+// As with [io.Writer], implementations must not retain p.
+type LevelWriter interface {
+	io.Writer
+	WriteLevel(level slog.Level, p []byte) (n int, err error)
 }
 
 // NewHandler creates a new [slog.Handler] instance with given options.
 func NewHandler(writer io.Writer, options ...Option) *Handler {
-	return &Handler{
+	h := &Handler{
 		writer:  writer,
 		options: getOptions(options),
 		handleContextPool: &sync.Pool{
 			New: newHandleContext,
 		},
 	}
+	if h.options.levelRegistry != nil {
+		h.levelNode = h.options.levelRegistry.node("")
+	}
+	if h.options.levelController != nil {
+		h.options.levelController.attach(h)
+	}
+	return h
 }
 
 // Enabled controls log output. It is called by slog package.
 func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.isLevelEnabled(ctx, level) {
+		return true
+	}
+	if !h.options.debugSessions {
+		return false
+	}
+
+	// records of debug session are logged regardless of the level
+	_, debug := DebugSession(ctx)
+	return debug
+}
+
+func (h *Handler) isLevelEnabled(ctx context.Context, level slog.Level) bool {
+	if h.levelNode != nil {
+		if minLevel, ok := h.levelNode.get(); ok {
+			return level >= minLevel
+		}
+	}
 	return h.options.levelF(ctx, level)
 }
 
 // WithAttrs creates new [slog.Handler] with given default attributes.
 // It is called by slog package.
 func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	//var resolvedFields []slog.Attr
+	// do not modify the slice of the caller
+	attrs = slices.Clone(attrs)
+	levelNode := h.levelNode
 
 	for i := 0; i < len(attrs); i++ {
 		// per slog.Handler doc we should ignore empty attributes
@@ -57,24 +98,51 @@ func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
 			i--
 			continue
 		}
+		// attributes with empty key or map values may expand to multiple attributes, which are processed next
+		if expanded, ok := expandAttr(attrs[i], h.options.expandMaps); ok {
+			attrs = slices.Replace(attrs, i, i+1, expanded...)
+			i--
+			continue
+		}
 		// ignore attributes conflicting with builtins
 		if h.attrPrefix == "" && isIgnoredKey(attrs[i].Key) {
 			attrs = slices.Delete(attrs, i, i+1)
 			i--
 			continue
 		}
+		// resolve the level of named logger before the value is preformatted
+		if h.options.levelRegistry != nil {
+			if logger, ok := findAttrValue(attrs[i], h.attrPrefix, "log.logger"); ok {
+				levelNode = h.options.levelRegistry.node(logger.String())
+			}
+		}
+
 		attrs[i].Key = h.attrPrefix + attrs[i].Key
+		if h.options.redactor != nil {
+			if attrs[i], _ = h.options.redactor.redactAttr(attrs[i].Key, attrs[i]); attrs[i].Equal(slog.Attr{}) {
+				attrs = slices.Delete(attrs, i, i+1)
+				i--
+				continue
+			}
+		}
+		if h.options.scrubber != nil {
+			attrs[i], _ = h.options.scrubber.scrubAttr(attrs[i], nil)
+		}
 		if shouldPreformat(attrs[i].Value.Kind()) {
 			attrs[i].Value = preformatValue(attrs[i].Value)
 		}
 	}
 
+	slices.SortStableFunc(attrs, isEarlierAttr)
+	attributes := mergeSortedAttrs(make([]slog.Attr, 0, len(h.attributes)+len(attrs)), h.attributes, attrs, nil)
+
 	return &Handler{
 		writer:            h.writer,
 		options:           h.options,
 		handleContextPool: h.handleContextPool,
 		attrPrefix:        h.attrPrefix,
-		attributes:        append(h.attributes, attrs),
+		attributes:        dedupSortedAttrs(attributes),
+		levelNode:         levelNode,
 	}
 }
 
@@ -90,5 +158,6 @@ func (h *Handler) WithGroup(name string) slog.Handler {
 		handleContextPool: h.handleContextPool,
 		attrPrefix:        newGroupPrefix,
 		attributes:        h.attributes,
+		levelNode:         h.levelNode,
 	}
 }
@@ -1,8 +1,15 @@
 package ecslog
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
 	"testing"
+	"time"
 )
 
 type nilWriter struct{}
@@ -11,6 +18,14 @@ func (n *nilWriter) Write(src []byte) (int, error) {
 	return len(src), nil
 }
 
+// assertAllocs fails the benchmark if f allocates more than maxAllocs times per run
+func assertAllocs(b *testing.B, maxAllocs float64, f func()) {
+	b.Helper()
+	if allocs := testing.AllocsPerRun(100, f); allocs > maxAllocs {
+		b.Errorf("expected at most %v allocations, got %v", maxAllocs, allocs)
+	}
+}
+
 func BenchmarkHandler_Handle(b *testing.B) {
 	sl := slog.New(slog.NewJSONHandler(&nilWriter{}, nil))
 	b.Run("basic", func(b *testing.B) {
@@ -57,6 +72,10 @@ func BenchmarkHandler_HandleEcslog(b *testing.B) {
 				slog.String("log.file", "test"),
 			)
 		}
+		// the only allocation is the attribute passed as any to Info
+		assertAllocs(b, 1, func() {
+			ecs.Info("test", slog.String("log.file", "test"))
+		})
 	})
 
 	b.Run("Complex", func(b *testing.B) {
@@ -72,11 +91,67 @@ func BenchmarkHandler_HandleEcslog(b *testing.B) {
 		}
 	})
 
+	b.Run("AnyTypes", func(b *testing.B) {
+		// values are converted to attributes outside the loop, as boxing to any allocates
+		attrs := []slog.Attr{
+			slog.Any("client.ip", netip.MustParseAddr("192.168.1.10")),
+			slog.Any("server.ip", net.ParseIP("2001:db8::1")),
+			slog.Any("url.full", &url.URL{Scheme: "https", Host: "example.com", Path: "/api/orders", RawQuery: "id=1"}),
+			slog.Any("labels", map[string]string{"team": "payments", "tier": "backend"}),
+			slog.Any("tags", []string{"checkout", "payment"}),
+			slog.Any("error.message", errors.New("connection refused")),
+			slog.Any("event.sequence", []int{1, 2, 3}),
+			slog.Any("event.original", []byte("raw payload")),
+			slog.Any("labels.month", time.January),
+		}
+		ctx := context.Background()
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ecs.LogAttrs(ctx, slog.LevelInfo, "Hello World", attrs...)
+		}
+		// record with more than 5 attributes allocates its overflow slice
+		assertAllocs(b, 1, func() {
+			ecs.LogAttrs(ctx, slog.LevelInfo, "Hello World", attrs...)
+		})
+	})
+
 	b.Run("ComplexPreContext", func(b *testing.B) {
 		b.ReportAllocs()
 		nLog := ecs.With(
 			slog.String("log.syslog.hostname", "ecslog"),
 			slog.String("file.device", "sda"),
+			slog.String("service.name", "checkout"),
+			slog.String("service.version", "1.24.3"),
+			slog.String("service.environment", "production"),
+			slog.String("service.node.name", "checkout-7d9f8b6c5-x2x7q"),
+			slog.String("host.name", "node-12"),
+			slog.String("host.architecture", "amd64"),
+			slog.String("host.os.type", "linux"),
+			slog.String("host.os.kernel", "6.1.0"),
+			slog.String("container.id", "4f1c3e3b2a1d"),
+			slog.String("container.image.name", "registry.example.com/checkout"),
+			slog.String("container.image.tag", "1.24.3"),
+			slog.String("orchestrator.type", "kubernetes"),
+			slog.String("orchestrator.namespace", "shop"),
+			slog.String("orchestrator.cluster.name", "eu-west-1"),
+			slog.String("cloud.provider", "aws"),
+			slog.String("cloud.region", "eu-west-1"),
+			slog.String("cloud.availability_zone", "eu-west-1a"),
+			slog.String("cloud.account.id", "123456789012"),
+			slog.String("event.dataset", "checkout.app"),
+			slog.String("event.module", "checkout"),
+			slog.String("labels.team", "payments"),
+			slog.String("labels.tier", "backend"),
+			slog.String("process.name", "checkout"),
+			slog.Int("process.pid", 1),
+			slog.String("trace.id", "4bf92f3577b34da6a3ce929d0e0e4736"),
+			slog.String("transaction.id", "00f067aa0ba902b7"),
+			slog.String("user.id", "42"),
+			slog.String("session.id", "s-1234"),
+			slog.String("url.domain", "shop.example.com"),
+			slog.String("http.request.method", "POST"),
+			slog.Group("agent", slog.String("name", "ecslog"), slog.String("type", "slog")),
 		)
 		for i := 0; i < b.N; i++ {
 			nLog.Info("Hello World",
@@ -85,5 +160,35 @@ func BenchmarkHandler_HandleEcslog(b *testing.B) {
 				slog.Int("log.syslog.priority", 1),
 			)
 		}
+		assertAllocs(b, 3, func() {
+			nLog.Info("Hello World",
+				slog.String("event.action", "test"),
+				slog.String("log.source", "Test()"),
+				slog.Int("log.syslog.priority", 1),
+			)
+		})
+	})
+
+	b.Run("ManyAttrs", func(b *testing.B) {
+		// the attributes fit handleCtxMaxAttrsSize, so the grown buffer is returned to the pool
+		handlerAttrs := make([]slog.Attr, 80)
+		for i := range handlerAttrs {
+			handlerAttrs[i] = slog.Int("labels.h"+strconv.Itoa(i), i)
+		}
+		attrs := make([]slog.Attr, 30)
+		for i := range attrs {
+			attrs[i] = slog.Int("labels.r"+strconv.Itoa(i), i)
+		}
+		nLog := slog.New(NewHandler(&nilWriter{}).WithAttrs(handlerAttrs))
+		ctx := context.Background()
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			nLog.LogAttrs(ctx, slog.LevelInfo, "Hello World", attrs...)
+		}
+		// record with more than 5 attributes allocates its overflow slice
+		assertAllocs(b, 1, func() {
+			nLog.LogAttrs(ctx, slog.LevelInfo, "Hello World", attrs...)
+		})
 	})
 }
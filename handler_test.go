@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"reflect"
 	"runtime"
+	"slices"
 	"strings"
 	"testing"
 	"testing/synctest"
@@ -445,14 +447,91 @@ func TestHandler_Handle_WithAttrs(t *testing.T) {
 	}
 }
 
+func TestHandler_Handle_WithAttrsMerge(t *testing.T) {
+	buff := bytes.NewBuffer(nil)
+	ecs := slog.New(NewHandler(buff, WithTimestamp(false)))
+
+	attrs := []any{slog.String("service.name", "first"), slog.String("log.logger", "db")}
+	base := ecs.With(attrs...).With(
+		slog.String("service.name", "second"),
+		slog.Group("event", slog.String("dataset", "base")),
+		slog.Float64("labels.ratio", 0.5),
+	)
+	base.WithGroup("http").Info("", slog.String("event.dataset", "ignored"), slog.Int("status", 200))
+	base.Info("", slog.String("event.dataset", "record"), slog.String("host.name", "node"))
+
+	var expectedOutput = []val{
+		{
+			"log":     val{"level": "INFO", "logger": "db"},
+			"service": val{"name": "second"},
+			"event":   val{"dataset": "base"},
+			"labels":  val{"ratio": 0.5},
+			"http":    val{"event": val{"dataset": "ignored"}, "status": float64(200)},
+		},
+		{
+			"log":     val{"level": "INFO", "logger": "db"},
+			"service": val{"name": "second"},
+			"event":   val{"dataset": "base"},
+			"labels":  val{"ratio": 0.5},
+			"host":    val{"name": "node"},
+		},
+	}
+
+	output := unmarshalLogs(t, buff)
+	if !reflect.DeepEqual(output, expectedOutput) {
+		t.Errorf("mismatched log data\nEXP: %#v\nGOT: %#v", expectedOutput, output)
+	}
+	if attrs[0].(slog.Attr).Value.String() != "first" {
+		t.Errorf("expected attributes of the caller to be unmodified, got %v", attrs)
+	}
+}
+
+func TestHandler_appendAttrs(t *testing.T) {
+	keys := []string{"a", "a.b", "a.c", "b", "b.a.c", "log.level", "log.logger", "ab", "a.b.c"}
+	base := NewHandler(io.Discard, WithSource(true))
+
+	for i := range keys {
+		handlerAttrs := make([]slog.Attr, 0, len(keys))
+		for j, key := range keys {
+			if (i+j)%3 != 0 {
+				handlerAttrs = append(handlerAttrs, slog.Int(key, j))
+			}
+		}
+		h := base.WithAttrs(handlerAttrs).(*Handler)
+
+		record := slog.NewRecord(time.Time{}, slog.LevelInfo, "", 0)
+		for j, key := range keys {
+			if (i+j)%2 == 0 {
+				record.AddAttrs(slog.Int(key, 100+j))
+			}
+		}
+
+		// merged attributes must be encoded as stably sorted attributes of handler and record
+		expected := []slog.Attr{slog.String("log.level", "INFO")}
+		expected = append(expected, handlerAttrs...)
+		record.Attrs(func(attr slog.Attr) bool {
+			expected = append(expected, attr)
+			return true
+		})
+		slices.SortStableFunc(expected, isEarlierAttr)
+
+		got := h.appendAttrs(h.getHandleCtx(), t.Context(), record, nil)
+		if exp, out := resolveRecord(nil, time.Time{}, "", expected), resolveRecord(nil, time.Time{}, "", got); !bytes.Equal(exp, out) {
+			t.Errorf("mismatched output\nEXP: %s\nGOT: %s", exp, out)
+		}
+	}
+}
+
 func TestHandler_Handle_Any(t *testing.T) {
 	buff := bytes.NewBuffer(nil)
 	ecs := slog.New(NewHandler(buff, WithTimestamp(false), WithLogLevel(slog.LevelWarn)))
 
 	ecs.Warn("", slog.Any("foo", []string{"test1", "test2"}))
+	ecs.Warn("", slog.Any("error.message", errors.New("boom")))
 
 	var expectedOutput = []val{
 		{"log": val{"level": "WARN"}, "foo": arr{"test1", "test2"}},
+		{"log": val{"level": "WARN"}, "error": val{"message": "boom"}},
 	}
 
 	output := unmarshalLogs(t, buff)
@@ -0,0 +1,167 @@
+package msgpack
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Ext is a decoded extension value.
+type Ext struct {
+	Type int8
+	Data []byte
+}
+
+// Decode reads a single value from r. Values are decoded as nil, bool, int64, uint64,
+// float64, string, []byte, []any, map[string]any (non-string keys are formatted by fmt) or [Ext].
+func Decode(r *bufio.Reader) (any, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return decodeMap(r, int(b&0x0f))
+	case b&0xf0 == 0x90:
+		return decodeArray(r, int(b&0x0f))
+	case b&0xe0 == 0xa0:
+		return decodeString(r, int(b&0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readLength(r, b-0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return readBytes(r, n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := readLength(r, b-0xc7)
+		if err != nil {
+			return nil, err
+		}
+		return decodeExt(r, n)
+	case 0xca:
+		v, err := readUint(r, 4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := readUint(r, 8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := readUint(r, 1<<(b-0xcc))
+		return v, err
+	case 0xd0:
+		v, err := readUint(r, 1)
+		return int64(int8(v)), err
+	case 0xd1:
+		v, err := readUint(r, 2)
+		return int64(int16(v)), err
+	case 0xd2:
+		v, err := readUint(r, 4)
+		return int64(int32(v)), err
+	case 0xd3:
+		v, err := readUint(r, 8)
+		return int64(v), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return decodeExt(r, 1<<(b-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := readLength(r, b-0xd9)
+		if err != nil {
+			return nil, err
+		}
+		return decodeString(r, n)
+	case 0xdc, 0xdd:
+		n, err := readLength(r, b-0xdc+1)
+		if err != nil {
+			return nil, err
+		}
+		return decodeArray(r, n)
+	case 0xde, 0xdf:
+		n, err := readLength(r, b-0xde+1)
+		if err != nil {
+			return nil, err
+		}
+		return decodeMap(r, n)
+	}
+
+	return nil, fmt.Errorf("msgpack: invalid format 0x%x", b)
+}
+
+// readLength reads length stored in 1, 2 or 4 bytes (sizeClass 0, 1 and 2)
+func readLength(r *bufio.Reader, sizeClass byte) (int, error) {
+	v, err := readUint(r, 1<<sizeClass)
+	return int(v), err
+}
+
+func readUint(r *bufio.Reader, size int) (uint64, error) {
+	var buff [8]byte
+	if _, err := io.ReadFull(r, buff[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buff[:]), nil
+}
+
+func readBytes(r *bufio.Reader, n int) ([]byte, error) {
+	buff := make([]byte, n)
+	_, err := io.ReadFull(r, buff)
+	return buff, err
+}
+
+func decodeString(r *bufio.Reader, n int) (any, error) {
+	buff, err := readBytes(r, n)
+	return string(buff), err
+}
+
+func decodeExt(r *bufio.Reader, n int) (any, error) {
+	extType, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := readBytes(r, n)
+	return Ext{Type: int8(extType), Data: data}, err
+}
+
+func decodeArray(r *bufio.Reader, n int) (any, error) {
+	arr := make([]any, n)
+	for i := range arr {
+		v, err := Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = v
+	}
+	return arr, nil
+}
+
+func decodeMap(r *bufio.Reader, n int) (any, error) {
+	m := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		key, err := Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := key.(string); ok {
+			m[s] = v
+		} else {
+			m[fmt.Sprint(key)] = v
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,172 @@
+// Package msgpack implements the subset of MessagePack format needed
+// by Fluent Forward protocol.
+//
+// The encoding follows https://github.com/msgpack/msgpack/blob/master/spec.md.
+package msgpack
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"slices"
+	"time"
+)
+
+// EventTimeExt is the extension type of Fluentd EventTime.
+const EventTimeExt = 0
+
+// AppendNil appends nil.
+func AppendNil(dst []byte) []byte {
+	return append(dst, 0xc0)
+}
+
+// AppendBool appends boolean value.
+func AppendBool(dst []byte, v bool) []byte {
+	if v {
+		return append(dst, 0xc3)
+	}
+	return append(dst, 0xc2)
+}
+
+// AppendInt appends integer using the smallest possible representation.
+func AppendInt(dst []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return AppendUint(dst, uint64(v))
+	case v >= -32:
+		return append(dst, byte(v))
+	case v >= math.MinInt8:
+		return append(dst, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xd2), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(dst, 0xd3), uint64(v))
+	}
+}
+
+// AppendUint appends unsigned integer using the smallest possible representation.
+func AppendUint(dst []byte, v uint64) []byte {
+	switch {
+	case v <= 0x7f:
+		return append(dst, byte(v))
+	case v <= math.MaxUint8:
+		return append(dst, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xce), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(dst, 0xcf), v)
+	}
+}
+
+// AppendFloat64 appends float64 value.
+func AppendFloat64(dst []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(append(dst, 0xcb), math.Float64bits(v))
+}
+
+// AppendString appends UTF-8 string.
+func AppendString(dst []byte, v string) []byte {
+	n := len(v)
+	switch {
+	case n <= 31:
+		dst = append(dst, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		dst = append(dst, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		dst = binary.BigEndian.AppendUint16(append(dst, 0xda), uint16(n))
+	default:
+		dst = binary.BigEndian.AppendUint32(append(dst, 0xdb), uint32(n))
+	}
+	return append(dst, v...)
+}
+
+// AppendBinHeader appends header of binary data of given length, the data itself
+// has to be appended by the caller.
+func AppendBinHeader(dst []byte, n int) []byte {
+	switch {
+	case n <= math.MaxUint8:
+		return append(dst, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xc5), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(dst, 0xc6), uint32(n))
+	}
+}
+
+// AppendArrayHeader appends header of array with n elements.
+func AppendArrayHeader(dst []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(dst, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(dst, 0xdd), uint32(n))
+	}
+}
+
+// AppendMapHeader appends header of map with n key-value pairs.
+func AppendMapHeader(dst []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(dst, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(dst, 0xdf), uint32(n))
+	}
+}
+
+// AppendEventTime appends Fluentd EventTime extension (fixext 8).
+func AppendEventTime(dst []byte, t time.Time) []byte {
+	dst = append(dst, 0xd7, EventTimeExt)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(dst, uint32(t.Nanosecond()))
+}
+
+// AppendValue appends value decoded by encoding/json (with UseNumber).
+// Map keys are sorted to produce stable output.
+func AppendValue(dst []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return AppendNil(dst)
+	case bool:
+		return AppendBool(dst, v)
+	case string:
+		return AppendString(dst, v)
+	case float64:
+		return AppendFloat64(dst, v)
+	case int64:
+		return AppendInt(dst, v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return AppendInt(dst, i)
+		}
+		f, _ := v.Float64()
+		return AppendFloat64(dst, f)
+	case []any:
+		dst = AppendArrayHeader(dst, len(v))
+		for _, item := range v {
+			dst = AppendValue(dst, item)
+		}
+		return dst
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		dst = AppendMapHeader(dst, len(v))
+		for _, key := range keys {
+			dst = AppendString(dst, key)
+			dst = AppendValue(dst, v[key])
+		}
+		return dst
+	default:
+		return AppendNil(dst)
+	}
+}
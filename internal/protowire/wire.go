@@ -0,0 +1,130 @@
+// Package protowire implements the subset of Protocol Buffers wire format
+// needed to encode OTLP messages without generated code.
+//
+// The encoding follows https://protobuf.dev/programming-guides/encoding/.
+package protowire
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Type is the wire type of a field.
+type Type int
+
+const (
+	VarintType  Type = 0
+	Fixed64Type Type = 1
+	BytesType   Type = 2
+	Fixed32Type Type = 5
+)
+
+// AppendTag appends the key of the field with given number and wire type.
+func AppendTag(b []byte, num int, typ Type) []byte {
+	return AppendVarint(b, uint64(num)<<3|uint64(typ))
+}
+
+// AppendVarint appends v as base 128 varint.
+func AppendVarint(b []byte, v uint64) []byte {
+	return binary.AppendUvarint(b, v)
+}
+
+// AppendVarintField appends varint field, zero value is omitted.
+func AppendVarintField(b []byte, num int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	return AppendVarint(AppendTag(b, num, VarintType), v)
+}
+
+// AppendFixed64Field appends fixed64 field, zero value is omitted.
+func AppendFixed64Field(b []byte, num int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.LittleEndian.AppendUint64(AppendTag(b, num, Fixed64Type), v)
+}
+
+// AppendDoubleField appends double field. Unlike other fields, zero value is not omitted,
+// as the function is used for members of oneof.
+func AppendDoubleField(b []byte, num int, v float64) []byte {
+	return binary.LittleEndian.AppendUint64(AppendTag(b, num, Fixed64Type), math.Float64bits(v))
+}
+
+// AppendStringField appends string field, empty value is omitted.
+func AppendStringField(b []byte, num int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = AppendTag(b, num, BytesType)
+	b = AppendVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// AppendBytesField appends bytes field, empty value is omitted.
+func AppendBytesField(b []byte, num int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = AppendTag(b, num, BytesType)
+	b = AppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// AppendMessageField appends embedded message field, the content of which is appended by fn.
+func AppendMessageField(b []byte, num int, fn func(b []byte) []byte) []byte {
+	b = AppendTag(b, num, BytesType)
+
+	// the length is not known yet, so it is inserted when the message is complete
+	start := len(b)
+	b = fn(b)
+	size := len(b) - start
+
+	var length [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(length[:], uint64(size))
+	b = append(b, length[:n]...)
+	copy(b[start+n:], b[start:start+size])
+	copy(b[start:], length[:n])
+	return b
+}
+
+var errInvalid = errors.New("protowire: invalid encoding")
+
+// ConsumeField parses a single field from b. The value is returned as varint value
+// for VarintType, Fixed64Type and Fixed32Type, and as data for BytesType.
+// It returns the number of consumed bytes.
+func ConsumeField(b []byte) (num int, typ Type, value uint64, data []byte, n int, err error) {
+	key, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, 0, 0, nil, 0, errInvalid
+	}
+	num, typ = int(key>>3), Type(key&7)
+
+	switch typ {
+	case VarintType:
+		v, m := binary.Uvarint(b[n:])
+		if m <= 0 {
+			return 0, 0, 0, nil, 0, errInvalid
+		}
+		return num, typ, v, nil, n + m, nil
+	case Fixed64Type:
+		if len(b) < n+8 {
+			return 0, 0, 0, nil, 0, errInvalid
+		}
+		return num, typ, binary.LittleEndian.Uint64(b[n:]), nil, n + 8, nil
+	case Fixed32Type:
+		if len(b) < n+4 {
+			return 0, 0, 0, nil, 0, errInvalid
+		}
+		return num, typ, uint64(binary.LittleEndian.Uint32(b[n:])), nil, n + 4, nil
+	case BytesType:
+		size, m := binary.Uvarint(b[n:])
+		if m <= 0 || uint64(len(b)-n-m) < size {
+			return 0, 0, 0, nil, 0, errInvalid
+		}
+		n += m
+		return num, typ, 0, b[n : n+int(size)], n + int(size), nil
+	}
+	return 0, 0, 0, nil, 0, errInvalid
+}
@@ -10,7 +10,7 @@ import (
 // The JSON encoding is taken from Go standard library encoding/json,
 // specifically appendString() function in src/encoding/json/encode.go.
 // However, it is modified to ignore HTML escaping.
-func AppendStringContent(dst []byte, src string) []byte {
+func AppendStringContent[Bytes []byte | string](dst []byte, src Bytes) []byte {
 	start := 0
 	for i := 0; i < len(src); {
 		if b := src[i]; b < utf8.RuneSelf {
@@ -49,7 +49,7 @@ func AppendStringContent(dst []byte, src string) []byte {
 		// so that it can be stack allocated. This slows down []byte slightly
 		// due to the extra copy, but keeps string performance roughly the same.
 		n := min(len(src)-i, utf8.UTFMax)
-		c, size := utf8.DecodeRuneInString(src[i : i+n])
+		c, size := utf8.DecodeRuneInString(string(src[i : i+n]))
 		if c == utf8.RuneError && size == 1 {
 			dst = append(dst, src[start:i]...)
 			dst = append(dst, `\ufffd`...)
@@ -0,0 +1,230 @@
+package ecslog
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// journaldFieldMaxLen is the maximum length of journal field name
+const journaldFieldMaxLen = 64
+
+// journaldFields maps ECS fields to the well-known journal fields
+var journaldFields = map[string]string{
+	"message":             "MESSAGE",
+	"log.origin.file":     "CODE_FILE",
+	"log.origin.line":     "CODE_LINE",
+	"log.origin.function": "CODE_FUNC",
+}
+
+type journaldOptions struct {
+	socket     string
+	identifier string
+}
+
+// JournaldOption configures [JournaldWriter].
+type JournaldOption func(*journaldOptions)
+
+// WithJournaldSocket sets the path of the journal socket. Default value is "/run/systemd/journal/socket".
+func WithJournaldSocket(path string) JournaldOption {
+	return func(o *journaldOptions) {
+		o.socket = path
+	}
+}
+
+// WithJournaldIdentifier sets SYSLOG_IDENTIFIER used when the record does not contain "service.name".
+// Default value is the name of the executable.
+func WithJournaldIdentifier(identifier string) JournaldOption {
+	return func(o *journaldOptions) {
+		o.identifier = identifier
+	}
+}
+
+// JournaldWriter is an [io.Writer] which sends lines produced by [Handler] to systemd-journald
+// using its native protocol, so the fields of the record are kept as structured journal fields.
+//
+// "message" is sent as MESSAGE, "log.level" as syslog PRIORITY and "log.origin.*" as CODE_FILE,
+// CODE_LINE and CODE_FUNC. All other fields become uppercase journal fields with underscores
+// instead of dots (e.g. "event.action" becomes EVENT_ACTION). Objects in arrays are sent as JSON.
+//
+// Entries too large for a datagram are passed to journald in a sealed memfd (on Linux).
+type JournaldWriter struct {
+	options journaldOptions
+
+	mu     sync.Mutex
+	conn   *net.UnixConn
+	buffer []byte
+}
+
+// NewJournaldWriter creates a new [JournaldWriter] and connects to the journal socket.
+func NewJournaldWriter(options ...JournaldOption) (*JournaldWriter, error) {
+	opts := journaldOptions{
+		socket:     "/run/systemd/journal/socket",
+		identifier: filepath.Base(os.Args[0]),
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	w := &JournaldWriter{options: opts}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write sends each line of p as a separate journal entry.
+func (w *JournaldWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for line := range bytes.Lines(p) {
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if len(line) == 0 {
+			continue
+		}
+
+		record, err := decodeRecord(line)
+		if err != nil {
+			return 0, err
+		}
+		w.buffer = w.appendEntry(w.buffer[:0], record)
+		if err := w.send(w.buffer); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close closes the connection.
+func (w *JournaldWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *JournaldWriter) connect() error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: w.options.socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// send must be called with w.mu held
+func (w *JournaldWriter) send(entry []byte) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				continue
+			}
+		}
+
+		_, err = w.conn.Write(entry)
+		if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+			err = sendJournalFD(w.conn, entry)
+		}
+		if err == nil {
+			return nil
+		}
+
+		// journald may have been restarted
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+func (w *JournaldWriter) appendEntry(output []byte, record map[string]any) []byte {
+	output = appendJournalField(output, "PRIORITY",
+		strconv.Itoa(syslogSeverity(parseLevel(lookupString(record, "log.level")))))
+	output = appendJournalField(output, "SYSLOG_IDENTIFIER",
+		cmp.Or(lookupString(record, "service.name"), w.options.identifier))
+
+	flattenRecord(record, "", func(key string, value any) {
+		if key == "log.level" || value == nil {
+			return
+		}
+
+		name, ok := journaldFields[key]
+		if !ok {
+			name = journalFieldName(key)
+		}
+		if name == "" {
+			return
+		}
+
+		switch value := value.(type) {
+		case string:
+			output = appendJournalField(output, name, value)
+		case json.Number:
+			output = appendJournalField(output, name, value.String())
+		case bool:
+			output = appendJournalField(output, name, strconv.FormatBool(value))
+		case []any:
+			// multiple values of the same field are allowed by journal
+			for _, item := range value {
+				if s, ok := item.(string); ok {
+					output = appendJournalField(output, name, s)
+					continue
+				}
+				encoded, _ := json.Marshal(item)
+				output = appendJournalField(output, name, string(encoded))
+			}
+		}
+	})
+	return output
+}
+
+// journalFieldName converts dotted key to journal field name, which may contain only uppercase
+// letters, digits and underscores and must not start with underscore or digit
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+
+	name = strings.TrimLeft(name, "_0123456789")
+	if len(name) > journaldFieldMaxLen {
+		name = name[:journaldFieldMaxLen]
+	}
+	return name
+}
+
+// appendJournalField encodes the field using the native protocol, values with newlines
+// are encoded with explicit length
+func appendJournalField(output []byte, name, value string) []byte {
+	output = append(output, name...)
+	if strings.IndexByte(value, '\n') == -1 {
+		output = append(output, '=')
+		output = append(output, value...)
+		return append(output, '\n')
+	}
+
+	output = append(output, '\n')
+	output = binary.LittleEndian.AppendUint64(output, uint64(len(value)))
+	output = append(output, value...)
+	return append(output, '\n')
+}
@@ -0,0 +1,104 @@
+//go:build linux
+
+package ecslog
+
+import (
+	"cmp"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+
+	fAddSeals   = 0x409
+	fSealSeal   = 0x1
+	fSealShrink = 0x2
+	fSealGrow   = 0x4
+	fSealWrite  = 0x8
+)
+
+// sendJournalFD passes the entry to journald in a file descriptor,
+// which is used when the entry does not fit into a datagram
+func sendJournalFD(conn *net.UnixConn, entry []byte) error {
+	f, err := journalFile(entry)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	// net.UnixConn does not allow WriteMsgUnix on connected datagram socket
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(f.Fd()))
+	var sendErr error
+	err = rawConn.Write(func(fd uintptr) bool {
+		sendErr = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return sendErr != syscall.EAGAIN
+	})
+	return cmp.Or(err, sendErr)
+}
+
+func journalFile(entry []byte) (*os.File, error) {
+	if trap := memfdCreateTrap(); trap != 0 {
+		name := []byte("ecslog-journald\x00")
+		fd, _, errno := syscall.Syscall(trap, uintptr(unsafe.Pointer(&name[0])), mfdCloexec|mfdAllowSealing, 0)
+		if errno == 0 {
+			f := os.NewFile(fd, "memfd:ecslog-journald")
+			if _, err := f.Write(entry); err != nil {
+				_ = f.Close()
+				return nil, err
+			}
+
+			// journald accepts only sealed memfd from unprivileged processes
+			_, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, fAddSeals, fSealSeal|fSealShrink|fSealGrow|fSealWrite)
+			if errno != 0 {
+				_ = f.Close()
+				return nil, errno
+			}
+			return f, nil
+		}
+	}
+
+	// kernels without memfd: unlinked file in /dev/shm is accepted by journald as well
+	f, err := os.CreateTemp("/dev/shm", "ecslog-journald-")
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(f.Name())
+	if _, err := f.Write(entry); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// memfdCreateTrap returns the number of memfd_create syscall, which is not defined
+// by package syscall for all architectures
+func memfdCreateTrap() uintptr {
+	switch runtime.GOARCH {
+	case "amd64":
+		return 319
+	case "386":
+		return 356
+	case "arm":
+		return 385
+	case "arm64", "riscv64", "loong64":
+		return 279
+	case "ppc64", "ppc64le":
+		return 360
+	case "s390x":
+		return 350
+	case "mips64", "mips64le":
+		return 5314
+	case "mips", "mipsle":
+		return 4354
+	}
+	return 0
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package ecslog
+
+import (
+	"net"
+	"syscall"
+)
+
+// sendJournalFD is supported only on Linux, where journald runs
+func sendJournalFD(_ *net.UnixConn, _ []byte) error {
+	return syscall.EMSGSIZE
+}
@@ -0,0 +1,179 @@
+//go:build linux
+
+package ecslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// listenJournald creates a unixgram socket standing in for the journal socket
+func listenJournald(t *testing.T) (*net.UnixConn, string) {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "journal.socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram not supported: %s", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn, socket
+}
+
+// readJournalEntry receives a single entry, reading it from passed file descriptor if needed
+func readJournalEntry(t *testing.T, conn *net.UnixConn) []byte {
+	t.Helper()
+
+	buffer := make([]byte, 1<<16)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buffer, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oobn == 0 {
+		return buffer[:n]
+	}
+
+	messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		t.Fatal(err)
+	}
+	fds, err := syscall.ParseUnixRights(&messages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "journal entry")
+	defer func() { _ = f.Close() }()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// parseJournalEntry decodes journal native protocol
+func parseJournalEntry(t *testing.T, entry []byte) map[string][]string {
+	t.Helper()
+
+	fields := make(map[string][]string)
+	for len(entry) > 0 {
+		end := bytes.IndexByte(entry, '\n')
+		if end == -1 {
+			t.Fatalf("unterminated field: %q", entry)
+		}
+		line := entry[:end]
+		entry = entry[end+1:]
+
+		if name, value, ok := bytes.Cut(line, []byte{'='}); ok {
+			fields[string(name)] = append(fields[string(name)], string(value))
+			continue
+		}
+
+		size := binary.LittleEndian.Uint64(entry)
+		value := entry[8 : 8+size]
+		if entry[8+size] != '\n' {
+			t.Fatalf("invalid binary field %s", line)
+		}
+		fields[string(line)] = append(fields[string(line)], string(value))
+		entry = entry[9+size:]
+	}
+	return fields
+}
+
+func TestJournaldWriter(t *testing.T) {
+	server, socket := listenJournald(t)
+
+	w, err := NewJournaldWriter(WithJournaldSocket(socket), WithJournaldIdentifier("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = w.Close() }()
+
+	r := slog.NewRecord(time.Unix(1768150842, 426480000), slog.LevelError, "first line\nsecond line", 0)
+	r.AddAttrs(
+		slog.String("event.action", "test"),
+		slog.Int("http.response.status_code", 503),
+		slog.Bool("event.success", false),
+		slog.Any("tags", []string{"a", "b"}),
+		slog.String("log.origin.file.name", "main.go"),
+		slog.String("_hidden", "trusted"),
+	)
+	if err := NewHandler(w).Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"MESSAGE":                   {"first line\nsecond line"},
+		"PRIORITY":                  {"3"},
+		"SYSLOG_IDENTIFIER":         {"test"},
+		"TIMESTAMP":                 {"2026-01-11T17:00:42.42648Z"},
+		"EVENT_ACTION":              {"test"},
+		"EVENT_SUCCESS":             {"false"},
+		"HTTP_RESPONSE_STATUS_CODE": {"503"},
+		"TAGS":                      {"a", "b"},
+		"LOG_ORIGIN_FILE_NAME":      {"main.go"},
+		"HIDDEN":                    {"trusted"},
+	}
+	fields := parseJournalEntry(t, readJournalEntry(t, server))
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("mismatched entry\nEXP: %#v\nGOT: %#v", expected, fields)
+	}
+}
+
+func TestJournaldWriter_Source(t *testing.T) {
+	server, socket := listenJournald(t)
+
+	w, err := NewJournaldWriter(WithJournaldSocket(socket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = w.Close() }()
+
+	slog.New(NewHandler(w, WithSource(true))).Info("Hello World", "service.name", "checkout")
+
+	fields := parseJournalEntry(t, readJournalEntry(t, server))
+	if fields["SYSLOG_IDENTIFIER"][0] != "checkout" || fields["PRIORITY"][0] != "6" {
+		t.Errorf("unexpected header fields: %v", fields)
+	}
+	if !strings.HasSuffix(fields["CODE_FILE"][0], "journald_test.go") || fields["CODE_LINE"] == nil ||
+		!strings.HasSuffix(fields["CODE_FUNC"][0], "TestJournaldWriter_Source") {
+		t.Errorf("unexpected code fields: %v", fields)
+	}
+}
+
+func TestJournaldWriter_LargeEntry(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("passing entries in file descriptor is supported only on Linux")
+	}
+	server, socket := listenJournald(t)
+
+	w, err := NewJournaldWriter(WithJournaldSocket(socket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = w.Close() }()
+
+	msg := strings.Repeat("x", 1<<20)
+	slog.New(NewHandler(w)).Info(msg)
+
+	fields := parseJournalEntry(t, readJournalEntry(t, server))
+	if fields["MESSAGE"][0] != msg {
+		t.Errorf("unexpected message of length %d", len(fields["MESSAGE"][0]))
+	}
+}
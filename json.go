@@ -1,9 +1,16 @@
 package ecslog
 
 import (
+	"encoding"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +23,9 @@ import (
 // It is fairly cheap to format for example Kind.Uint64 to given buffer for every log entry,
 // but it makes sense to pre-format these kinds to newly allocated buffers.
 var preformattedKinds = [16]bool{
+	slog.KindString:    true,
+	slog.KindFloat64:   true,
+	slog.KindTime:      true,
 	slog.KindAny:       true,
 	slog.KindGroup:     true,
 	slog.KindLogValuer: true,
@@ -24,6 +34,21 @@ var preformattedKinds = [16]bool{
 type preformattedValue struct {
 	// value contains preformatted value with necessary quotations
 	value []byte
+	// original is the value before formatting, used for lookups of attributes
+	original slog.Value
+}
+
+// unwrapPreformatted returns the original value of preformatted value
+func unwrapPreformatted(value slog.Value) slog.Value {
+	if value.Kind() == slog.KindAny {
+		switch pref := value.Any().(type) {
+		case preformattedValue:
+			return pref.original
+		case *preformattedValue:
+			return pref.original
+		}
+	}
+	return value
 }
 
 func resolveRecord(output []byte, t0 time.Time, msg string, sortedAttrs []slog.Attr) []byte {
@@ -50,6 +75,20 @@ func resolveRecord(output []byte, t0 time.Time, msg string, sortedAttrs []slog.A
 	return output
 }
 
+// appendInternalRecord encodes a record produced by the package itself (e.g. summary of dropped records)
+// as a single JSON line. Given attributes do not have to be sorted and they take precedence
+// over the default ones.
+func appendInternalRecord(output []byte, t0 time.Time, level slog.Level, msg string, attrs ...slog.Attr) []byte {
+	attrs = append([]slog.Attr{
+		slog.String("log.level", level.String()),
+		slog.String("log.logger", "ecslog"),
+	}, attrs...)
+	slices.SortStableFunc(attrs, isEarlierAttr)
+
+	output = resolveRecord(output, t0, msg, attrs)
+	return append(output, '\n')
+}
+
 func resolveGroup(output []byte, prefixLen int, attributes []slog.Attr) []byte {
 	output = append(output, '{')
 	output = resolveGroupContent(output, false, prefixLen, attributes)
@@ -151,8 +190,7 @@ func preformatValue(value slog.Value) slog.Value {
 	var formattedValue []byte
 	formatted := appendJsonValue(formattedValue, value)
 
-	return slog.AnyValue(preformattedValue{value: formatted})
-
+	return slog.AnyValue(preformattedValue{value: formatted, original: value.Resolve()})
 }
 
 func appendJsonKV(output []byte, hasValue bool, key string, value slog.Value) []byte {
@@ -187,14 +225,9 @@ func appendJsonValue(output []byte, value slog.Value) []byte {
 	case slog.KindDuration:
 		output = strconv.AppendInt(output, value.Duration().Nanoseconds(), 10)
 	case slog.KindFloat64:
-		// adhere to json.Marshal with floats
-		output = appendMarshal(output, value.Float64())
+		output = appendFloat(output, value.Float64(), 64)
 	case slog.KindAny:
-		val := value.Any()
-		if pref, ok := val.(preformattedValue); ok {
-			return append(output, pref.value...)
-		}
-		output = appendMarshal(output, val)
+		output = appendJsonAny(output, value.Any())
 	default:
 		output = appendJsonString(output, fmt.Sprintf("ERR! invalid value: %#v", value.Any()))
 
@@ -202,6 +235,172 @@ func appendJsonValue(output []byte, value slog.Value) []byte {
 	return output
 }
 
+// appendJsonAny encodes common types without reflection and allocations,
+// other values are encoded by cached reflection encoders (see appendReflect)
+func appendJsonAny(output []byte, v any) []byte {
+	return appendAny(output, v, nil)
+}
+
+// appendAny is appendJsonAny for values nested in values encoded by reflection,
+// state is nil for top-level values
+func appendAny(output []byte, v any, state *encodeState) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(output, "null"...)
+	case preformattedValue:
+		return append(output, v.value...)
+	case *preformattedValue:
+		return append(output, v.value...)
+	case []byte:
+		if v == nil {
+			return append(output, "null"...)
+		}
+		output = append(output, '"')
+		output = base64.StdEncoding.AppendEncode(output, v)
+		return append(output, '"')
+	case net.IP:
+		if len(v) != 0 && len(v) != net.IPv4len && len(v) != net.IPv6len {
+			break
+		}
+		output = append(output, '"')
+		output, _ = v.AppendText(output)
+		return append(output, '"')
+	case netip.Addr:
+		if v.Zone() != "" {
+			return appendJsonString(output, v.String())
+		}
+		output = append(output, '"')
+		output = v.AppendTo(output)
+		return append(output, '"')
+	case *url.URL:
+		if v == nil {
+			return append(output, "null"...)
+		}
+		return appendURL(output, v)
+	case []string:
+		if v == nil {
+			return append(output, "null"...)
+		}
+		output = append(output, '[')
+		for i, item := range v {
+			if i > 0 {
+				output = append(output, ',')
+			}
+			output = appendJsonString(output, item)
+		}
+		return append(output, ']')
+	case []int:
+		if v == nil {
+			return append(output, "null"...)
+		}
+		output = append(output, '[')
+		for i, item := range v {
+			if i > 0 {
+				output = append(output, ',')
+			}
+			output = strconv.AppendInt(output, int64(item), 10)
+		}
+		return append(output, ']')
+	case map[string]string:
+		if v == nil {
+			return append(output, "null"...)
+		}
+		// keys are sorted as by encoding/json
+		var keysBuf [16]string
+		keys := keysBuf[:0]
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		output = append(output, '{')
+		for i, key := range keys {
+			output = appendKey(output, i > 0, key)
+			output = appendJsonString(output, v[key])
+		}
+		return append(output, '}')
+	case json.Number:
+		return appendJsonNumber(output, v)
+	case json.Marshaler:
+		if isNilPointer(v) {
+			return append(output, "null"...)
+		}
+		b, err := v.MarshalJSON()
+		if err != nil {
+			return appendJsonString(output, "ERR! "+err.Error())
+		}
+		return appendCompactJSON(output, b)
+	case encoding.TextMarshaler:
+		if isNilPointer(v) {
+			return append(output, "null"...)
+		}
+		text, err := v.MarshalText()
+		if err != nil {
+			return appendJsonString(output, "ERR! "+err.Error())
+		}
+		return appendJsonString(output, text)
+	case error:
+		if isNilPointer(v) {
+			return append(output, "null"...)
+		}
+		return appendJsonString(output, v.Error())
+	case fmt.Stringer:
+		if isNilPointer(v) {
+			return append(output, "null"...)
+		}
+		return appendJsonString(output, v.String())
+	}
+	return appendReflect(output, v, state)
+}
+
+// appendURL encodes common absolute URLs as url.URL.String without allocations,
+// the others are encoded by url.URL.String
+func appendURL(output []byte, u *url.URL) []byte {
+	if u.Opaque != "" || u.User != nil || u.OmitHost || u.Scheme == "" || !isPlainHost(u.Host) {
+		return appendJsonString(output, u.String())
+	}
+
+	output = append(output, '"')
+	output = sjson.AppendStringContent(output, u.Scheme)
+	output = append(output, "://"...)
+	output = append(output, u.Host...)
+	path := u.EscapedPath()
+	if path != "" && path[0] != '/' {
+		output = append(output, '/')
+	}
+	output = sjson.AppendStringContent(output, path)
+	if u.ForceQuery || u.RawQuery != "" {
+		output = append(output, '?')
+		output = sjson.AppendStringContent(output, u.RawQuery)
+	}
+	if u.Fragment != "" {
+		output = append(output, '#')
+		output = sjson.AppendStringContent(output, u.EscapedFragment())
+	}
+	return append(output, '"')
+}
+
+// isPlainHost reports whether the host does not need escaping
+func isPlainHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	for i := 0; i < len(host); i++ {
+		c := host[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '.' || c == '-' || c == ':' || c == '[' || c == ']') {
+			return false
+		}
+	}
+	return true
+}
+
+// isNilPointer reports whether v is nil pointer, whose methods may panic
+func isNilPointer(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
+
 func appendTime(output []byte, t0 time.Time) []byte {
 	output = append(output, '"')
 	output = t0.AppendFormat(output, time.RFC3339Nano)
@@ -209,32 +408,10 @@ func appendTime(output []byte, t0 time.Time) []byte {
 	return output
 }
 
-func appendJsonString(output []byte, value string) []byte {
+func appendJsonString[Bytes []byte | string](output []byte, value Bytes) []byte {
 	output = append(output, '"')
 	output = sjson.AppendStringContent(output, value)
 	output = append(output, '"')
 
 	return output
 }
-
-type simpleWriter struct {
-	buffer []byte
-}
-
-func (w *simpleWriter) Write(p []byte) (n int, err error) {
-	w.buffer = append(w.buffer, p...)
-	return len(p), nil
-}
-
-func appendMarshal(output []byte, v any) []byte {
-	writer := simpleWriter{buffer: output}
-	enc := json.NewEncoder(&writer)
-	enc.SetEscapeHTML(false)
-	err := enc.Encode(v)
-	if err != nil {
-		output = appendJsonString(output, "ERR!"+err.Error())
-	}
-
-	// remove newline
-	return writer.buffer[:len(writer.buffer)-1]
-}
@@ -0,0 +1,306 @@
+package ecslog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// levelOverride is temporary level of a logger
+type levelOverride struct {
+	previous    slog.Level
+	hasPrevious bool
+	expires     time.Time
+	timer       *time.Timer
+	// generation is incremented by each extension, so the timer of the previous TTL,
+	// which may have fired already, does not restore the level
+	generation uint64
+}
+
+// LevelController controls the global level and the levels of loggers named by "log.logger"
+// attribute at runtime. It is passed to [NewHandler] with [WithLevelController] option.
+//
+// Like [slog.LevelVar], the levels are read atomically, so the changes are cheap for the handlers.
+// The levels may be set permanently or temporarily for given TTL, after which the previous level
+// is restored. Every change is logged as a record with "event.kind":"event" by the first [Handler]
+// created with the controller.
+//
+// The controller is also [http.Handler] serving an admin endpoint, see [LevelController.ServeHTTP].
+type LevelController struct {
+	registry *LevelRegistry
+	handler  atomic.Pointer[Handler]
+
+	mu        sync.Mutex
+	overrides map[string]*levelOverride
+}
+
+// NewLevelController creates a new [LevelController] with given global level.
+func NewLevelController(level slog.Level) *LevelController {
+	c := &LevelController{
+		registry:  NewLevelRegistry(),
+		overrides: make(map[string]*levelOverride),
+	}
+	c.registry.Set("", level)
+	return c
+}
+
+// Level returns the global level. It implements [slog.Leveler].
+func (c *LevelController) Level() slog.Level {
+	level, _ := c.registry.Level("")
+	return level
+}
+
+// SetLevel sets the global level.
+func (c *LevelController) SetLevel(level slog.Level) {
+	c.SetLoggerLevel("", level)
+}
+
+// SetLoggerLevel sets the level of given logger and its descendants.
+// Logger "" refers to the global level. Temporary level of the logger is cancelled.
+func (c *LevelController) SetLoggerLevel(logger string, level slog.Level) {
+	c.mu.Lock()
+	c.cancelOverride(logger)
+	change := c.set(logger, level, "")
+	c.mu.Unlock()
+
+	c.logChange(change)
+}
+
+// UnsetLoggerLevel removes the level of given logger, so the level of its ancestor applies.
+// The global level cannot be removed.
+func (c *LevelController) UnsetLoggerLevel(logger string) {
+	if logger == "" {
+		return
+	}
+
+	c.mu.Lock()
+	c.cancelOverride(logger)
+	change := c.unset(logger, "")
+	c.mu.Unlock()
+
+	c.logChange(change)
+}
+
+// SetLoggerLevelTemporary sets the level of given logger for given TTL, after which
+// the previous level is restored.
+func (c *LevelController) SetLoggerLevelTemporary(logger string, level slog.Level, ttl time.Duration) {
+	c.mu.Lock()
+
+	override, ok := c.overrides[logger]
+	if ok {
+		// keep the level from before the first override
+		override.timer.Stop()
+	} else {
+		override = &levelOverride{}
+		override.previous, override.hasPrevious = c.registry.Levels()[logger]
+		c.overrides[logger] = override
+	}
+
+	override.generation++
+	generation := override.generation
+	override.expires = time.Now().Add(ttl)
+	override.timer = time.AfterFunc(ttl, func() {
+		c.mu.Lock()
+		if c.overrides[logger] != override || override.generation != generation {
+			c.mu.Unlock()
+			return
+		}
+		delete(c.overrides, logger)
+		var change *levelChange
+		if override.hasPrevious {
+			change = c.set(logger, override.previous, "temporary level expired")
+		} else {
+			change = c.unset(logger, "temporary level expired")
+		}
+		c.mu.Unlock()
+
+		c.logChange(change)
+	})
+	change := c.set(logger, level, "temporary level for "+ttl.String())
+	c.mu.Unlock()
+
+	c.logChange(change)
+}
+
+// cancelOverride must be called with c.mu held
+func (c *LevelController) cancelOverride(logger string) {
+	if override, ok := c.overrides[logger]; ok {
+		override.timer.Stop()
+		delete(c.overrides, logger)
+	}
+}
+
+// levelChange describes the change of level, which is logged after c.mu is released,
+// so a slow writer does not block the other changes
+type levelChange struct {
+	logger      string
+	previous    slog.Level
+	hasPrevious bool
+	level       *slog.Level
+	reason      string
+}
+
+// set must be called with c.mu held, it returns nil when the level did not change
+func (c *LevelController) set(logger string, level slog.Level, reason string) *levelChange {
+	previous, hasPrevious := c.registry.Levels()[logger]
+	c.registry.Set(logger, level)
+	if hasPrevious && previous == level {
+		return nil
+	}
+	return &levelChange{logger: logger, previous: previous, hasPrevious: hasPrevious, level: &level, reason: reason}
+}
+
+// unset must be called with c.mu held, it returns nil when the level did not change
+func (c *LevelController) unset(logger string, reason string) *levelChange {
+	previous, hasPrevious := c.registry.Levels()[logger]
+	c.registry.Unset(logger)
+	if !hasPrevious {
+		return nil
+	}
+	return &levelChange{logger: logger, previous: previous, hasPrevious: true, reason: reason}
+}
+
+// attach sets the handler used for logging of the changes, the first one is kept
+func (c *LevelController) attach(h *Handler) {
+	c.handler.CompareAndSwap(nil, h)
+}
+
+// logChange must be called without c.mu held
+func (c *LevelController) logChange(change *levelChange) {
+	h := c.handler.Load()
+	if h == nil || change == nil {
+		return
+	}
+
+	name := change.logger
+	if name == "" {
+		name = "<global>"
+	}
+	from, to := "<unset>", "<unset>"
+	if change.hasPrevious {
+		from = change.previous.String()
+	}
+	if change.level != nil {
+		to = change.level.String()
+	}
+
+	record := slog.NewRecord(time.Now(), slog.LevelInfo,
+		fmt.Sprintf("level of logger %q changed from %s to %s", name, from, to), 0)
+	record.AddAttrs(
+		slog.String("event.kind", "event"),
+		slog.String("event.category", "configuration"),
+		slog.String("event.type", "change"),
+		slog.String("event.action", "log-level-changed"),
+		slog.String("labels.logger", change.logger),
+		slog.String("labels.previous_level", from),
+		slog.String("labels.level", to),
+	)
+	if change.reason != "" {
+		record.AddAttrs(slog.String("event.reason", change.reason))
+	}
+
+	// the change is logged regardless of the levels
+	_ = h.handleWithAttrs(context.Background(), record, []slog.Attr{slog.String("log.logger", "ecslog")})
+}
+
+// levelControllerState is JSON representation of the levels served by LevelController
+type levelControllerState struct {
+	Level     string               `json:"level"`
+	Loggers   map[string]string    `json:"loggers"`
+	Temporary map[string]time.Time `json:"temporary"`
+}
+
+// levelControllerRequest is JSON body of PUT request
+type levelControllerRequest struct {
+	Logger string `json:"logger"`
+	Level  string `json:"level"`
+	TTL    string `json:"ttl"`
+}
+
+// ServeHTTP serves the admin endpoint for the levels.
+//
+//   - GET returns the levels as JSON object with "level" (the global level), "loggers" (levels of
+//     loggers) and "temporary" (expiration of temporary levels).
+//   - PUT sets the level given by JSON object with "level", optional "logger" (the global level is set
+//     when empty) and optional "ttl" (e.g. "15m") making the level temporary.
+//   - DELETE removes the level of logger given by "logger" query parameter.
+//
+// All methods respond with the levels after the change. The endpoint does not authenticate
+// the requests, so it should be exposed only on internal listener or behind authentication.
+func (c *LevelController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if err := c.serveSet(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		logger := r.URL.Query().Get("logger")
+		if logger == "" {
+			http.Error(w, "ecslog: missing logger", http.StatusBadRequest)
+			return
+		}
+		c.UnsetLoggerLevel(logger)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(c.state())
+}
+
+func (c *LevelController) serveSet(r *http.Request) error {
+	var request levelControllerRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return fmt.Errorf("ecslog: invalid request: %w", err)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(request.Level)); err != nil {
+		return fmt.Errorf("ecslog: invalid level: %w", err)
+	}
+
+	if request.TTL == "" {
+		c.SetLoggerLevel(request.Logger, level)
+		return nil
+	}
+	ttl, err := time.ParseDuration(request.TTL)
+	if err != nil {
+		return fmt.Errorf("ecslog: invalid ttl: %w", err)
+	}
+	if ttl <= 0 {
+		return errors.New("ecslog: ttl must be positive")
+	}
+	c.SetLoggerLevelTemporary(request.Logger, level, ttl)
+	return nil
+}
+
+func (c *LevelController) state() levelControllerState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := levelControllerState{
+		Loggers:   make(map[string]string),
+		Temporary: make(map[string]time.Time),
+	}
+	for logger, level := range c.registry.Levels() {
+		if logger == "" {
+			state.Level = level.String()
+			continue
+		}
+		state.Loggers[logger] = level.String()
+	}
+	for logger, override := range c.overrides {
+		state.Temporary[logger] = override.expires
+	}
+	return state
+}
@@ -0,0 +1,132 @@
+package ecslog
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func serveLevelController(t *testing.T, c *LevelController, method, target, body string) (int, levelControllerState) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	c.ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+
+	var state levelControllerState
+	if recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &state); err != nil {
+			t.Fatalf("invalid response: %s", err)
+		}
+	}
+	return recorder.Code, state
+}
+
+func TestLevelController(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		buff := &syncBuffer{}
+		controller := NewLevelController(slog.LevelInfo)
+		h := NewHandler(buff, WithTimestamp(false), WithLevelController(controller))
+		db := h.WithAttrs([]slog.Attr{slog.String("log.logger", "db.pool")})
+		ctx := context.Background()
+
+		code, state := serveLevelController(t, controller, http.MethodPut, "/", `{"logger":"db","level":"debug","ttl":"1m"}`)
+		if code != http.StatusOK || state.Loggers["db"] != "DEBUG" || !state.Temporary["db"].Equal(time.Now().Add(time.Minute)) {
+			t.Fatalf("unexpected response %d: %v", code, state)
+		}
+		if !db.Enabled(ctx, slog.LevelDebug) || h.Enabled(ctx, slog.LevelDebug) {
+			t.Error("expected debug level only for db logger")
+		}
+
+		time.Sleep(time.Minute)
+		synctest.Wait()
+		if db.Enabled(ctx, slog.LevelDebug) {
+			t.Error("expected temporary level to expire")
+		}
+
+		code, state = serveLevelController(t, controller, http.MethodPut, "/", `{"level":"warn"}`)
+		if code != http.StatusOK || state.Level != "WARN" || controller.Level() != slog.LevelWarn {
+			t.Errorf("unexpected response %d: %v", code, state)
+		}
+		if db.Enabled(ctx, slog.LevelInfo) {
+			t.Error("expected global level to apply")
+		}
+
+		code, _ = serveLevelController(t, controller, http.MethodPut, "/", `{"logger":"db","level":"verbose"}`)
+		if code != http.StatusBadRequest {
+			t.Errorf("expected bad request for invalid level, got %d", code)
+		}
+		code, _ = serveLevelController(t, controller, http.MethodPost, "/", "")
+		if code != http.StatusMethodNotAllowed {
+			t.Errorf("expected method not allowed, got %d", code)
+		}
+
+		controller.SetLoggerLevel("http", slog.LevelError)
+		code, state = serveLevelController(t, controller, http.MethodDelete, "/?logger=http", "")
+		if code != http.StatusOK || len(state.Loggers) != 0 {
+			t.Errorf("unexpected response %d: %v", code, state)
+		}
+
+		var messages []any
+		for _, line := range unmarshalLogs(t, &buff.buff) {
+			event := line["event"].(map[string]any)
+			if event["kind"] != "event" || event["action"] != "log-level-changed" {
+				t.Errorf("unexpected event: %v", event)
+			}
+			messages = append(messages, line["message"])
+		}
+		expected := []any{
+			`level of logger "db" changed from <unset> to DEBUG`,
+			`level of logger "db" changed from DEBUG to <unset>`,
+			`level of logger "<global>" changed from INFO to WARN`,
+			`level of logger "http" changed from <unset> to ERROR`,
+			`level of logger "http" changed from ERROR to <unset>`,
+		}
+		if !reflect.DeepEqual(messages, expected) {
+			t.Errorf("mismatched messages\nEXP: %v\nGOT: %v", expected, messages)
+		}
+	})
+}
+
+// blockingWriter blocks writes until release is closed
+type blockingWriter struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.entered <- struct{}{}
+	<-w.release
+	return len(p), nil
+}
+
+func TestLevelController_SlowWriter(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		writer := &blockingWriter{entered: make(chan struct{}, 16), release: make(chan struct{})}
+		c := NewLevelController(slog.LevelInfo)
+		NewHandler(writer, WithLevelController(c))
+
+		go c.SetLoggerLevel("db", slog.LevelDebug)
+		<-writer.entered
+
+		// the change blocked in the writer does not block the other changes
+		changed := make(chan struct{})
+		go func() {
+			c.SetLoggerLevel("http", slog.LevelWarn)
+			close(changed)
+		}()
+		synctest.Wait()
+		if level, _ := c.registry.Level("http"); level != slog.LevelWarn {
+			t.Errorf("expected level to be changed while the writer is blocked, got %s", level)
+		}
+
+		close(writer.release)
+		<-changed
+	})
+}
@@ -0,0 +1,155 @@
+package ecslog
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// levelUnset marks levelNode without matching rule
+const levelUnset = math.MinInt64
+
+// levelNode holds the effective level of a single logger name
+type levelNode struct {
+	level atomic.Int64
+}
+
+func (n *levelNode) get() (slog.Level, bool) {
+	level := n.level.Load()
+	if level == levelUnset {
+		return 0, false
+	}
+	return slog.Level(level), true
+}
+
+// LevelRegistry holds minimum levels of loggers named by "log.logger" attribute.
+// The levels apply hierarchically, level of "db" applies also to "db.pool" unless it has its own level.
+// Level of logger "" applies to all loggers, including the records without "log.logger".
+//
+// The registry is used by [Handler] with [WithLevelRegistry] option. The level is resolved when
+// the "log.logger" attribute is added by [Handler.WithAttrs], so [Handler.Enabled] only loads
+// the level atomically. The levels may be changed at any time.
+type LevelRegistry struct {
+	mu     sync.Mutex
+	levels map[string]slog.Level
+	nodes  map[string]*levelNode
+}
+
+// NewLevelRegistry creates a new empty [LevelRegistry].
+func NewLevelRegistry() *LevelRegistry {
+	return &LevelRegistry{
+		levels: make(map[string]slog.Level),
+		nodes:  make(map[string]*levelNode),
+	}
+}
+
+// ParseLevelRegistry creates a new [LevelRegistry] from comma separated list of levels
+// (e.g. "info,db=debug,http=warn"). Level without logger name applies to all loggers.
+func ParseLevelRegistry(spec string) (*LevelRegistry, error) {
+	r := NewLevelRegistry()
+	for item := range strings.SplitSeq(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		logger, levelText, found := strings.Cut(item, "=")
+		if !found {
+			logger, levelText = "", item
+		}
+
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(levelText))); err != nil {
+			return nil, fmt.Errorf("ecslog: invalid level of logger %q: %w", logger, err)
+		}
+		r.levels[strings.TrimSpace(logger)] = level
+	}
+	return r, nil
+}
+
+// Set sets the minimum level of given logger and its descendants.
+func (r *LevelRegistry) Set(logger string, level slog.Level) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.levels[logger] = level
+	r.update()
+}
+
+// Unset removes the level of given logger, so the level of its ancestor applies.
+func (r *LevelRegistry) Unset(logger string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.levels, logger)
+	r.update()
+}
+
+// Level returns the effective level of given logger and whether any level applies.
+func (r *LevelRegistry) Level(logger string) (slog.Level, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.resolve(logger)
+}
+
+// Levels returns a copy of the levels set in the registry.
+func (r *LevelRegistry) Levels() map[string]slog.Level {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return maps.Clone(r.levels)
+}
+
+// node returns the shared level node of given logger
+func (r *LevelRegistry) node(logger string) *levelNode {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if n, ok := r.nodes[logger]; ok {
+		return n
+	}
+
+	n := &levelNode{}
+	r.store(n, logger)
+	r.nodes[logger] = n
+	return n
+}
+
+// update recomputes levels of all nodes, it must be called with r.mu held
+func (r *LevelRegistry) update() {
+	for logger, n := range r.nodes {
+		r.store(n, logger)
+	}
+}
+
+func (r *LevelRegistry) store(n *levelNode, logger string) {
+	if level, ok := r.resolve(logger); ok {
+		n.level.Store(int64(level))
+	} else {
+		n.level.Store(levelUnset)
+	}
+}
+
+// resolve finds the level of the logger or its closest ancestor, it must be called with r.mu held
+func (r *LevelRegistry) resolve(logger string) (slog.Level, bool) {
+	for {
+		if level, ok := r.levels[logger]; ok {
+			return level, true
+		}
+		if logger == "" {
+			return 0, false
+		}
+
+		i := strings.LastIndexByte(logger, groupSeparator)
+		if i == -1 {
+			logger = ""
+		} else {
+			logger = logger[:i]
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package ecslog
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+var levelRegistryTestData = []struct {
+	name    string
+	logger  string
+	level   slog.Level
+	enabled bool
+}{
+	{"Root", "", slog.LevelInfo, true},
+	{"RootBelow", "", slog.LevelDebug, false},
+	{"Exact", "db", slog.LevelDebug, true},
+	{"Descendant", "db.pool", slog.LevelDebug, true},
+	{"OwnLevel", "db.pool.conn", slog.LevelInfo, false},
+	{"OwnLevelWarn", "db.pool.conn", slog.LevelWarn, true},
+	{"Warn", "http.client", slog.LevelInfo, false},
+	{"NotDescendant", "httpx", slog.LevelInfo, true},
+	{"Unknown", "cache", slog.LevelDebug, false},
+}
+
+func TestLevelRegistry(t *testing.T) {
+	registry, err := ParseLevelRegistry("info, db=debug,http=warn,db.pool.conn=WARN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(io.Discard, WithLevelRegistry(registry))
+
+	for _, data := range levelRegistryTestData {
+		t.Run(data.name, func(t *testing.T) {
+			var logger slog.Handler = h
+			if data.logger != "" {
+				logger = h.WithAttrs([]slog.Attr{slog.String("log.logger", data.logger)})
+			}
+			if enabled := logger.Enabled(context.Background(), data.level); enabled != data.enabled {
+				t.Errorf("expected enabled %v for %s at %s", data.enabled, data.logger, data.level)
+			}
+		})
+	}
+}
+
+func TestLevelRegistry_Update(t *testing.T) {
+	registry := NewLevelRegistry()
+	h := NewHandler(io.Discard, WithLevelRegistry(registry), WithLogLevel(slog.LevelWarn))
+	logger := h.WithGroup("log").WithAttrs([]slog.Attr{slog.String("logger", "db.pool")})
+	ctx := context.Background()
+
+	if logger.Enabled(ctx, slog.LevelInfo) {
+		t.Error("expected WithLogLevel to apply without levels in registry")
+	}
+
+	registry.Set("db", slog.LevelDebug)
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		t.Error("expected level of parent logger to apply")
+	}
+
+	registry.Set("db.pool", slog.LevelError)
+	if logger.Enabled(ctx, slog.LevelWarn) {
+		t.Error("expected own level of logger to apply")
+	}
+
+	registry.Unset("db.pool")
+	registry.Unset("db")
+	if !logger.Enabled(ctx, slog.LevelWarn) || logger.Enabled(ctx, slog.LevelInfo) {
+		t.Error("expected WithLogLevel to apply after levels were unset")
+	}
+
+	if _, err := ParseLevelRegistry("db=verbose"); err == nil {
+		t.Error("expected error for invalid level")
+	}
+}
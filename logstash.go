@@ -0,0 +1,325 @@
+package ecslog
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type logstashOptions struct {
+	tlsConfig      *tls.Config
+	timeout        time.Duration
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	bufferSize     int
+	healthF        func(connected bool, err error)
+}
+
+// LogstashOption configures [LogstashWriter].
+type LogstashOption func(*logstashOptions)
+
+// WithLogstashTLSConfig enables TLS with given configuration.
+func WithLogstashTLSConfig(config *tls.Config) LogstashOption {
+	return func(o *logstashOptions) {
+		o.tlsConfig = config
+	}
+}
+
+// WithLogstashTimeout sets the timeout of dialing and writing to the connection.
+// Default value is 5s.
+func WithLogstashTimeout(timeout time.Duration) LogstashOption {
+	return func(o *logstashOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithLogstashBackoff sets the bounds of the exponential backoff between reconnection attempts.
+// Default values are 100ms and 30s.
+func WithLogstashBackoff(initialBackoff, maxBackoff time.Duration) LogstashOption {
+	return func(o *logstashOptions) {
+		o.initialBackoff = max(initialBackoff, time.Millisecond)
+		o.maxBackoff = max(maxBackoff, o.initialBackoff)
+	}
+}
+
+// WithLogstashBufferSize sets the maximum size in bytes of lines buffered while the server
+// is unreachable. Lines exceeding the size are dropped. Default value is 8MiB.
+func WithLogstashBufferSize(size int) LogstashOption {
+	return func(o *logstashOptions) {
+		o.bufferSize = size
+	}
+}
+
+// WithLogstashHealthFunc sets the function called when the connection is established
+// (connected is true) or lost (connected is false and err contains the cause).
+// The function is called from the background goroutine of the writer and must not block.
+func WithLogstashHealthFunc(f func(connected bool, err error)) LogstashOption {
+	return func(o *logstashOptions) {
+		o.healthF = f
+	}
+}
+
+// LogstashWriter is an [io.Writer] which streams lines produced by [Handler] to a TCP or TLS
+// endpoint, such as Logstash tcp input with json_lines codec.
+//
+// Lines are buffered and sent by a background goroutine, so the writes never block on the network.
+// When the connection is lost, the lines are kept in the buffer up to its size and the connection
+// is re-established with jittered exponential backoff. A line which was written only partially is
+// sent again as a whole over the new connection, so the lines are never split across connections.
+type LogstashWriter struct {
+	addr    string
+	options logstashOptions
+
+	mu       sync.Mutex
+	pending  []byte
+	buffered int
+	empty    chan struct{}
+	closed   bool
+
+	dropped atomic.Uint64
+
+	// conn and health state are used only by the background goroutine
+	conn      *logstashConn
+	connected bool
+	reported  bool
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewLogstashWriter creates a new [LogstashWriter] sending lines to given TCP address.
+// The connection is established in the background. The writer should be closed
+// by [LogstashWriter.Close].
+func NewLogstashWriter(addr string, options ...LogstashOption) *LogstashWriter {
+	opts := logstashOptions{
+		timeout:        5 * time.Second,
+		initialBackoff: 100 * time.Millisecond,
+		maxBackoff:     30 * time.Second,
+		bufferSize:     8 << 20,
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	w := &LogstashWriter{
+		addr:    addr,
+		options: opts,
+		empty:   make(chan struct{}),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write buffers the lines of p. Lines which do not fit into the buffer are dropped.
+func (w *LogstashWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	for line := range bytes.Lines(p) {
+		size := len(line)
+		if line[size-1] != '\n' {
+			size++
+		}
+		if w.buffered+size > w.options.bufferSize {
+			w.dropped.Add(1)
+			continue
+		}
+
+		w.pending = append(w.pending, line...)
+		if line[len(line)-1] != '\n' {
+			w.pending = append(w.pending, '\n')
+		}
+		w.buffered += size
+	}
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// Dropped returns the number of lines dropped due to the full buffer.
+func (w *LogstashWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Flush waits until all buffered lines are sent.
+func (w *LogstashWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	if w.buffered == 0 {
+		w.mu.Unlock()
+		return nil
+	}
+	empty := w.empty
+	w.mu.Unlock()
+
+	select {
+	case <-empty:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close waits until all buffered lines are sent or ctx is done and closes the connection.
+func (w *LogstashWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	err := w.Flush(ctx)
+
+	close(w.stop)
+	<-w.done
+
+	if w.conn != nil {
+		err = errors.Join(err, w.conn.Close())
+		w.conn = nil
+	}
+	return err
+}
+
+func (w *LogstashWriter) run() {
+	defer close(w.done)
+
+	backoff := newBackoff(w.options.initialBackoff, w.options.maxBackoff)
+	for {
+		select {
+		case <-w.wake:
+		case <-w.stop:
+			return
+		}
+
+		for {
+			err := w.send()
+			if err == nil {
+				backoff.reset()
+				break
+			}
+			w.disconnect(err)
+
+			if !backoff.wait(w.stop) {
+				return
+			}
+		}
+	}
+}
+
+// send writes the buffered lines until the buffer is empty
+func (w *LogstashWriter) send() error {
+	for {
+		w.mu.Lock()
+		if w.buffered == 0 {
+			w.mu.Unlock()
+			return nil
+		}
+		chunk := w.pending
+		w.pending = nil
+		w.mu.Unlock()
+
+		n, err := w.write(chunk)
+
+		// the incomplete line is sent again as a whole over the new connection
+		sent := bytes.LastIndexByte(chunk[:n], '\n') + 1
+		w.mu.Lock()
+		if sent < len(chunk) {
+			w.pending = append(chunk[sent:], w.pending...)
+		}
+		w.buffered -= sent
+		if w.buffered == 0 {
+			close(w.empty)
+			w.empty = make(chan struct{})
+		}
+		w.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (w *LogstashWriter) write(chunk []byte) (int, error) {
+	if w.conn != nil && w.conn.closed.Load() {
+		w.disconnect(errors.New("ecslog: connection closed by peer"))
+	}
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return 0, err
+		}
+	}
+
+	_ = w.conn.SetWriteDeadline(time.Now().Add(w.options.timeout))
+	return w.conn.Write(chunk)
+}
+
+func (w *LogstashWriter) connect() error {
+	dialer := &net.Dialer{Timeout: w.options.timeout}
+
+	var conn net.Conn
+	var err error
+	if w.options.tlsConfig != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: w.options.tlsConfig}).Dial("tcp", w.addr)
+	} else {
+		conn, err = dialer.Dial("tcp", w.addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.conn = &logstashConn{Conn: conn}
+	go w.conn.watch()
+	w.setHealth(true, nil)
+	return nil
+}
+
+func (w *LogstashWriter) disconnect(err error) {
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	w.setHealth(false, err)
+}
+
+// setHealth calls the health function when the state of the connection changes
+func (w *LogstashWriter) setHealth(connected bool, err error) {
+	if w.reported && w.connected == connected {
+		return
+	}
+	w.connected = connected
+	w.reported = true
+	if w.options.healthF != nil {
+		w.options.healthF(connected, err)
+	}
+}
+
+// logstashConn detects the connection closed by the peer. Writing to such connection
+// would succeed and the data would be lost.
+type logstashConn struct {
+	net.Conn
+	closed atomic.Bool
+}
+
+func (c *logstashConn) watch() {
+	// the server is not expected to send anything
+	_, _ = io.Copy(io.Discard, c.Conn)
+	c.closed.Store(true)
+}
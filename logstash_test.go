@@ -0,0 +1,221 @@
+package ecslog
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLogstash stores lines received by tcp input
+type fakeLogstash struct {
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns []net.Conn
+	lines []string
+}
+
+func newFakeLogstash(t *testing.T, listener net.Listener) *fakeLogstash {
+	t.Helper()
+
+	s := &fakeLogstash{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					s.mu.Lock()
+					s.lines = append(s.lines, scanner.Text())
+					s.mu.Unlock()
+				}
+			}()
+		}
+	}()
+	t.Cleanup(s.close)
+	return s
+}
+
+// close simulates restart of the server by closing all connections
+func (s *fakeLogstash) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeLogstash) messages(t *testing.T, expected int) []string {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		s.mu.Lock()
+		if len(s.lines) >= expected {
+			var messages []string
+			for _, line := range s.lines {
+				record, err := decodeRecord([]byte(line))
+				if err != nil {
+					t.Fatalf("invalid line %q: %s", line, err)
+				}
+				messages = append(messages, lookupString(record, "message"))
+			}
+			s.mu.Unlock()
+			return messages
+		}
+		s.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d lines", expected)
+	return nil
+}
+
+type healthEvent struct {
+	connected bool
+	failed    bool
+}
+
+func TestLogstashWriter_Reconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newFakeLogstash(t, listener)
+	defer func() { _ = listener.Close() }()
+
+	var mu sync.Mutex
+	var events []healthEvent
+	w := NewLogstashWriter(listener.Addr().String(),
+		WithLogstashBackoff(time.Millisecond, 10*time.Millisecond),
+		WithLogstashHealthFunc(func(connected bool, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, healthEvent{connected: connected, failed: err != nil})
+		}),
+	)
+	logger := slog.New(NewHandler(w))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	logger.Info("first")
+	if err := w.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	server.messages(t, 1)
+	server.close()
+	// let the writer notice the closed connection
+	time.Sleep(50 * time.Millisecond)
+
+	logger.Info("second")
+	logger.Info("third")
+	if err := w.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"first", "second", "third"}
+	if messages := server.messages(t, 3); !reflect.DeepEqual(messages, expected) {
+		t.Errorf("mismatched messages\nEXP: %v\nGOT: %v", expected, messages)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expectedEvents := []healthEvent{{connected: true}, {failed: true}, {connected: true}}
+	if !reflect.DeepEqual(events, expectedEvents) {
+		t.Errorf("mismatched health events\nEXP: %v\nGOT: %v", expectedEvents, events)
+	}
+}
+
+func TestLogstashWriter_Buffer(t *testing.T) {
+	// reserve the address, which is unreachable until the server starts
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	failed := make(chan error, 1)
+	w := NewLogstashWriter(addr,
+		WithLogstashBackoff(time.Millisecond, 10*time.Millisecond),
+		WithLogstashBufferSize(150),
+		WithLogstashHealthFunc(func(connected bool, err error) {
+			if !connected {
+				failed <- err
+			}
+		}),
+	)
+	logger := slog.New(NewHandler(w, WithTimestamp(false)))
+	for i := range 5 {
+		logger.Info(fmt.Sprintf("message %d", i))
+	}
+
+	if err := <-failed; err == nil {
+		t.Error("expected connection error")
+	}
+	if w.Dropped() != 2 {
+		t.Errorf("expected 2 dropped lines, got %d", w.Dropped())
+	}
+
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("address reused: %s", err)
+	}
+	defer func() { _ = listener.Close() }()
+	server := newFakeLogstash(t, listener)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"message 0", "message 1", "message 2"}
+	if messages := server.messages(t, 3); !reflect.DeepEqual(messages, expected) {
+		t.Errorf("mismatched messages\nEXP: %v\nGOT: %v", expected, messages)
+	}
+}
+
+func TestLogstashWriter_TLS(t *testing.T) {
+	// borrow the certificate of httptest server
+	certServer := httptest.NewTLSServer(nil)
+	defer certServer.Close()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certServer.TLS.Certificates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	server := newFakeLogstash(t, listener)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certServer.Certificate())
+	w := NewLogstashWriter(listener.Addr().String(), WithLogstashTLSConfig(&tls.Config{RootCAs: roots}))
+	slog.New(NewHandler(w)).Info("Hello World")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if messages := server.messages(t, 1); messages[0] != "Hello World" {
+		t.Errorf("unexpected message %q", messages[0])
+	}
+}
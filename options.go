@@ -12,8 +12,15 @@ type LogLevelFunc func(ctx context.Context, level slog.Level) bool
 type handlerOptions struct {
 	hideTimestamp bool
 	addSource     bool
+	expandMaps    bool
+	debugSessions bool
 
-	levelF LogLevelFunc
+	levelF          LogLevelFunc
+	levelRegistry   *LevelRegistry
+	levelController *LevelController
+
+	redactor *redactor
+	scrubber *scrubber
 }
 
 type Option func(*handlerOptions)
@@ -49,6 +56,27 @@ func WithSource(addSource bool) Option {
 	}
 }
 
+// WithMapExpansion option enables expansion of map[string]any and map[string]string values and
+// json.RawMessage objects into attributes with dotted keys, e.g. slog.Any("labels", map[string]any{"team": "a"})
+// is handled as slog.String("labels.team", "a"). The expanded attributes are deduplicated and merged
+// with other attributes, including those given to WithAttrs, instead of colliding with them.
+//
+// Nested maps and objects are expanded as well. Empty maps and maps with empty keys are not expanded.
+func WithMapExpansion(expandMaps bool) Option {
+	return func(h *handlerOptions) {
+		h.expandMaps = expandMaps
+	}
+}
+
+// WithDebugSessions option enables debug sessions (see [WithDebug]), the records logged with
+// the context of a debug session are logged regardless of the level. Without the option,
+// the context is not inspected for the session.
+func WithDebugSessions(enabled bool) Option {
+	return func(h *handlerOptions) {
+		h.debugSessions = enabled
+	}
+}
+
 // WithLogLevel options sets minimum log level to be outputted.
 // Default value is slog.LevelInfo.
 //
@@ -71,3 +99,57 @@ func WithLogLevelFunc(logLevelF LogLevelFunc) Option {
 		h.levelF = logLevelF
 	}
 }
+
+// WithLevelRegistry option sets the registry of levels per logger named by "log.logger" attribute.
+// When a level from the registry applies to the handler, it takes precedence over WithLogLevel
+// and WithLogLevelFunc, which are used otherwise.
+//
+// This option is exclusive with WithLevelController.
+func WithLevelRegistry(registry *LevelRegistry) Option {
+	return func(h *handlerOptions) {
+		h.levelRegistry = registry
+	}
+}
+
+// WithLevelController option sets the controller of levels, which can be changed at runtime.
+// The controller always has the global level, so it fully overrides WithLogLevel and
+// WithLogLevelFunc, which are not used at all.
+//
+// This option is exclusive with WithLevelRegistry.
+func WithLevelController(controller *LevelController) Option {
+	return func(h *handlerOptions) {
+		h.levelController = controller
+		h.levelRegistry = controller.registry
+	}
+}
+
+// WithRedaction option sets the rules redacting the values of attributes matching dotted key patterns,
+// e.g. "*.password" or "http.request.headers.authorization". The first matching rule applies.
+// See [RedactionRule] for details.
+//
+// The rules apply also to the attributes inside [slog.Group] values, attributes given to WithAttrs
+// and fields of values marshalled to JSON objects (e.g. structs and maps). Note that marshalled values
+// are decoded and encoded again when any rule may match their fields.
+func WithRedaction(rules ...RedactionRule) Option {
+	return func(h *handlerOptions) {
+		h.redactor = &redactor{rules: rules}
+	}
+}
+
+// WithScrubbing option enables scanning of string values, including the message, for sensitive data
+// found by given detectors, which is replaced with "[REDACTED:<name>]". When no detectors are given,
+// all built-in detectors are used ([ScrubCreditCard], [ScrubEmail], [ScrubJWT], [ScrubAWSKey],
+// [ScrubBearerToken] and [ScrubIBAN]).
+//
+// Strings inside [slog.Group] values and values marshalled to JSON are scanned as well. Note that
+// the marshalled values are decoded and encoded again when they contain a match.
+func WithScrubbing(detectors ...ScrubDetector) Option {
+	if len(detectors) == 0 {
+		detectors = []ScrubDetector{
+			ScrubCreditCard, ScrubEmail, ScrubJWT, ScrubAWSKey, ScrubBearerToken, ScrubIBAN,
+		}
+	}
+	return func(h *handlerOptions) {
+		h.scrubber = newScrubber(detectors)
+	}
+}
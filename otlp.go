@@ -0,0 +1,664 @@
+package ecslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oidq/ecslog/internal/protowire"
+)
+
+// OTLPProtocol selects the encoding of OTLP/HTTP requests.
+type OTLPProtocol int
+
+const (
+	// OTLPProtobuf encodes requests as binary protobuf ("application/x-protobuf").
+	OTLPProtobuf OTLPProtocol = iota
+	// OTLPJSON encodes requests as JSON ("application/json").
+	OTLPJSON
+)
+
+type otlpOptions struct {
+	protocol       OTLPProtocol
+	client         *http.Client
+	headers        map[string]string
+	scope          string
+	batchSize      int
+	flushInterval  time.Duration
+	bufferSize     int
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// OTLPOption configures [OTLPWriter].
+type OTLPOption func(*otlpOptions)
+
+// WithOTLPProtocol sets the encoding of requests. Default value is [OTLPProtobuf].
+func WithOTLPProtocol(protocol OTLPProtocol) OTLPOption {
+	return func(o *otlpOptions) {
+		o.protocol = protocol
+	}
+}
+
+// WithOTLPClient sets the HTTP client used for the requests. Default value is [http.DefaultClient].
+func WithOTLPClient(client *http.Client) OTLPOption {
+	return func(o *otlpOptions) {
+		o.client = client
+	}
+}
+
+// WithOTLPHeaders sets additional headers of requests (e.g. authentication).
+func WithOTLPHeaders(headers map[string]string) OTLPOption {
+	return func(o *otlpOptions) {
+		o.headers = headers
+	}
+}
+
+// WithOTLPScope sets the name of the instrumentation scope. Default value is "github.com/oidq/ecslog".
+func WithOTLPScope(name string) OTLPOption {
+	return func(o *otlpOptions) {
+		o.scope = name
+	}
+}
+
+// WithOTLPBatch sets the number of buffered records which triggers the export
+// and the maximum time records are buffered. Default values are 512 and 1s.
+func WithOTLPBatch(size int, interval time.Duration) OTLPOption {
+	return func(o *otlpOptions) {
+		o.batchSize = size
+		o.flushInterval = interval
+	}
+}
+
+// WithOTLPBufferSize sets the maximum number of records buffered while the previous batch
+// is being exported. Records exceeding the size are dropped. Default value is 8192.
+func WithOTLPBufferSize(size int) OTLPOption {
+	return func(o *otlpOptions) {
+		o.bufferSize = size
+	}
+}
+
+// WithOTLPRetries sets the maximum number of retries of exports failed with status 429, 5xx
+// or a network error and the bounds of the exponential backoff between them.
+// Default values are 3 retries with backoff from 100ms to 10s.
+func WithOTLPRetries(maxRetries int, initialBackoff, maxBackoff time.Duration) OTLPOption {
+	return func(o *otlpOptions) {
+		o.maxRetries = maxRetries
+		o.initialBackoff = initialBackoff
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// otlpKeyValue is an attribute, value is one of string, bool, int64, float64, []any or []otlpKeyValue
+type otlpKeyValue struct {
+	key   string
+	value any
+}
+
+type otlpLogRecord struct {
+	timeUnixNano         uint64
+	observedTimeUnixNano uint64
+	severityNumber       int
+	severityText         string
+	body                 string
+	traceID              []byte
+	spanID               []byte
+	attributes           []otlpKeyValue
+}
+
+type otlpResourceLogs struct {
+	key        string
+	attributes []otlpKeyValue
+	records    []otlpLogRecord
+}
+
+// OTLPWriter is an [io.Writer] which exports lines produced by [Handler] as OpenTelemetry log records
+// using OTLP/HTTP.
+//
+// "@timestamp" is used as the time of the record, "log.level" as its severity, "message" as the body
+// and "trace.id" with "span.id" as the trace context. Fields "service.*" and "host.*" become resource
+// attributes, all other fields become attributes of the record. The attributes keep ECS names
+// (e.g. "event.action").
+//
+// Records are buffered up to the buffer size and exported when the batch size is reached or when
+// the flush interval elapses. Exports failed with status 429, 5xx or a network error are retried with
+// exponential backoff, the records which could not be exported are dropped.
+type OTLPWriter struct {
+	endpoint string
+	options  otlpOptions
+
+	mu        sync.Mutex
+	resources []otlpResourceLogs
+	pending   int
+	closed    bool
+
+	dropped atomic.Uint64
+
+	// spoolDriven is set when the writer is wrapped by SpoolWriter
+	spoolDriven atomic.Bool
+
+	sendMu sync.Mutex
+	body   []byte
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewOTLPWriter creates a new [OTLPWriter] exporting to given endpoint (e.g. "http://localhost:4318/v1/logs").
+// It should be closed by [OTLPWriter.Close].
+func NewOTLPWriter(endpoint string, options ...OTLPOption) *OTLPWriter {
+	opts := otlpOptions{
+		client:         http.DefaultClient,
+		scope:          "github.com/oidq/ecslog",
+		batchSize:      512,
+		flushInterval:  time.Second,
+		bufferSize:     8192,
+		maxRetries:     3,
+		initialBackoff: 100 * time.Millisecond,
+		maxBackoff:     10 * time.Second,
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	w := &OTLPWriter{
+		endpoint: endpoint,
+		options:  opts,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write converts each line of p to a log record and buffers it.
+func (w *OTLPWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	for line := range bytes.Lines(p) {
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if len(line) == 0 {
+			continue
+		}
+
+		// the size of the records buffered for SpoolWriter is bounded by the spool
+		if w.pending >= w.options.bufferSize && !w.spoolDriven.Load() {
+			w.dropped.Add(1)
+			continue
+		}
+		record, err := decodeRecord(line)
+		if err != nil {
+			return 0, fmt.Errorf("ecslog: invalid record: %w", err)
+		}
+		logRecord, resource := toOTLP(record)
+		w.addRecord(logRecord, resource)
+	}
+
+	if w.pending >= w.options.batchSize {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Dropped returns the number of records dropped due to the full buffer or which could not be exported.
+func (w *OTLPWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Flush exports all buffered records. When the records were rejected with status other than
+// 429 or 5xx, the error is [*RejectedError].
+//
+// When the writer is wrapped by [SpoolWriter], the records which failed to be exported due to
+// a transient failure are kept in the buffer instead of being dropped and exported again with
+// the next flush.
+func (w *OTLPWriter) Flush(ctx context.Context) error {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+
+	w.mu.Lock()
+	resources := w.resources
+	count := w.pending
+	w.resources = nil
+	w.pending = 0
+	w.mu.Unlock()
+
+	if count == 0 {
+		return nil
+	}
+
+	err := w.send(ctx, resources)
+	if err != nil && w.spoolDriven.Load() && !errors.As(err, new(*RejectedError)) {
+		w.mu.Lock()
+		w.resources = append(resources, w.resources...)
+		w.pending += count
+		w.mu.Unlock()
+		return retainedError{err: err}
+	}
+	if err != nil {
+		w.dropped.Add(uint64(count))
+	}
+	return err
+}
+
+// setSpoolDriven implements spoolDriven
+func (w *OTLPWriter) setSpoolDriven() {
+	w.spoolDriven.Store(true)
+}
+
+// Close exports all buffered records and stops the background flushing.
+func (w *OTLPWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.stop)
+	<-w.done
+
+	return w.Flush(ctx)
+}
+
+func (w *OTLPWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.options.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.wake:
+		case <-w.stop:
+			return
+		}
+		if w.spoolDriven.Load() {
+			continue
+		}
+		// failed records are counted as dropped
+		_ = w.Flush(context.Background())
+	}
+}
+
+// addRecord must be called with w.mu held
+func (w *OTLPWriter) addRecord(record otlpLogRecord, resource otlpResourceLogs) {
+	w.pending++
+	for i := range w.resources {
+		if w.resources[i].key == resource.key {
+			w.resources[i].records = append(w.resources[i].records, record)
+			return
+		}
+	}
+	resource.records = []otlpLogRecord{record}
+	w.resources = append(w.resources, resource)
+}
+
+// send exports the records and retries the transient failures, it must be called with w.sendMu held
+func (w *OTLPWriter) send(ctx context.Context, resources []otlpResourceLogs) error {
+	contentType := "application/x-protobuf"
+	if w.options.protocol == OTLPJSON {
+		contentType = "application/json"
+		w.body = w.appendJSONRequest(w.body[:0], resources)
+	} else {
+		w.body = w.appendProtobufRequest(w.body[:0], resources)
+	}
+
+	backoff := newBackoff(w.options.initialBackoff, w.options.maxBackoff)
+	for attempt := 0; ; attempt++ {
+		retry, err := w.export(ctx, contentType)
+		if err == nil {
+			return nil
+		}
+		if !retry {
+			// the records would be rejected again
+			return &RejectedError{Err: err}
+		}
+		if attempt >= w.options.maxRetries {
+			return err
+		}
+		if !backoff.wait(ctx.Done()) {
+			return ctx.Err()
+		}
+	}
+}
+
+// export sends a single request with the encoded records, retry reports whether the failure is transient
+func (w *OTLPWriter) export(ctx context.Context, contentType string) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.endpoint, bytes.NewReader(w.body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range w.options.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := w.options.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return isRetryableStatus(resp.StatusCode), fmt.Errorf("ecslog: OTLP export failed with status %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// toOTLP converts decoded record to the log record and its resource
+func toOTLP(record map[string]any) (otlpLogRecord, otlpResourceLogs) {
+	logRecord := otlpLogRecord{
+		observedTimeUnixNano: uint64(time.Now().UnixNano()),
+	}
+	var resource otlpResourceLogs
+
+	flattenRecord(record, "", func(key string, value any) {
+		switch key {
+		case "@timestamp":
+			text, _ := value.(string)
+			if t0, err := time.Parse(time.RFC3339Nano, text); err == nil {
+				logRecord.timeUnixNano = uint64(t0.UnixNano())
+				return
+			}
+		case "log.level":
+			if text, ok := value.(string); ok {
+				logRecord.severityText = text
+				logRecord.severityNumber = otlpSeverity(parseLevel(text))
+				return
+			}
+		case "message":
+			if body, ok := value.(string); ok {
+				logRecord.body = body
+				return
+			}
+		case "trace.id":
+			if id := decodeTraceID(value, 16); id != nil {
+				logRecord.traceID = id
+				return
+			}
+		case "span.id":
+			if id := decodeTraceID(value, 8); id != nil {
+				logRecord.spanID = id
+				return
+			}
+		}
+
+		if value == nil {
+			return
+		}
+		attr := otlpKeyValue{key: key, value: toOTLPValue(value)}
+		if strings.HasPrefix(key, "service.") || strings.HasPrefix(key, "host.") {
+			resource.attributes = append(resource.attributes, attr)
+			resource.key += key + "=" + fmt.Sprint(attr.value) + "\x00"
+			return
+		}
+		logRecord.attributes = append(logRecord.attributes, attr)
+	})
+
+	return logRecord, resource
+}
+
+func toOTLPValue(value any) any {
+	switch value := value.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case []any:
+		values := make([]any, len(value))
+		for i := range value {
+			values[i] = toOTLPValue(value[i])
+		}
+		return values
+	case map[string]any:
+		var kvs []otlpKeyValue
+		flattenRecord(value, "", func(key string, value any) {
+			kvs = append(kvs, otlpKeyValue{key: key, value: toOTLPValue(value)})
+		})
+		return kvs
+	}
+	return value
+}
+
+// otlpSeverity maps slog.Level to OpenTelemetry severity number (DEBUG=5, INFO=9, WARN=13, ERROR=17)
+func otlpSeverity(level slog.Level) int {
+	return min(max(int(level)+9, 1), 24)
+}
+
+func decodeTraceID(value any, size int) []byte {
+	s, ok := value.(string)
+	if !ok || len(s) != size*2 {
+		return nil
+	}
+	id, err := hex.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	return id
+}
+
+// appendProtobufRequest encodes ExportLogsServiceRequest as protobuf
+func (w *OTLPWriter) appendProtobufRequest(b []byte, resources []otlpResourceLogs) []byte {
+	for _, resource := range resources {
+		// ExportLogsServiceRequest.resource_logs
+		b = protowire.AppendMessageField(b, 1, func(b []byte) []byte {
+			// ResourceLogs.resource
+			b = protowire.AppendMessageField(b, 1, func(b []byte) []byte {
+				return appendProtobufAttributes(b, 1, resource.attributes)
+			})
+			// ResourceLogs.scope_logs
+			return protowire.AppendMessageField(b, 2, func(b []byte) []byte {
+				// ScopeLogs.scope
+				b = protowire.AppendMessageField(b, 1, func(b []byte) []byte {
+					return protowire.AppendStringField(b, 1, w.options.scope)
+				})
+				for _, record := range resource.records {
+					// ScopeLogs.log_records
+					b = protowire.AppendMessageField(b, 2, func(b []byte) []byte {
+						return appendProtobufLogRecord(b, record)
+					})
+				}
+				return b
+			})
+		})
+	}
+	return b
+}
+
+func appendProtobufLogRecord(b []byte, record otlpLogRecord) []byte {
+	b = protowire.AppendFixed64Field(b, 1, record.timeUnixNano)
+	b = protowire.AppendVarintField(b, 2, uint64(record.severityNumber))
+	b = protowire.AppendStringField(b, 3, record.severityText)
+	if record.body != "" {
+		b = protowire.AppendMessageField(b, 5, func(b []byte) []byte {
+			return appendProtobufValue(b, record.body)
+		})
+	}
+	b = appendProtobufAttributes(b, 6, record.attributes)
+	b = protowire.AppendBytesField(b, 9, record.traceID)
+	b = protowire.AppendBytesField(b, 10, record.spanID)
+	b = protowire.AppendFixed64Field(b, 11, record.observedTimeUnixNano)
+	return b
+}
+
+func appendProtobufAttributes(b []byte, num int, attributes []otlpKeyValue) []byte {
+	for _, attr := range attributes {
+		b = protowire.AppendMessageField(b, num, func(b []byte) []byte {
+			b = protowire.AppendStringField(b, 1, attr.key)
+			return protowire.AppendMessageField(b, 2, func(b []byte) []byte {
+				return appendProtobufValue(b, attr.value)
+			})
+		})
+	}
+	return b
+}
+
+// appendProtobufValue encodes content of AnyValue
+func appendProtobufValue(b []byte, value any) []byte {
+	switch value := value.(type) {
+	case string:
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendVarint(b, uint64(len(value)))
+		return append(b, value...)
+	case bool:
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		if value {
+			return protowire.AppendVarint(b, 1)
+		}
+		return protowire.AppendVarint(b, 0)
+	case int64:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(value))
+	case float64:
+		return protowire.AppendDoubleField(b, 4, value)
+	case []any:
+		return protowire.AppendMessageField(b, 5, func(b []byte) []byte {
+			for _, item := range value {
+				b = protowire.AppendMessageField(b, 1, func(b []byte) []byte {
+					return appendProtobufValue(b, item)
+				})
+			}
+			return b
+		})
+	case []otlpKeyValue:
+		return protowire.AppendMessageField(b, 6, func(b []byte) []byte {
+			return appendProtobufAttributes(b, 1, value)
+		})
+	}
+	return b
+}
+
+// appendJSONRequest encodes ExportLogsServiceRequest in OTLP/JSON encoding
+func (w *OTLPWriter) appendJSONRequest(b []byte, resources []otlpResourceLogs) []byte {
+	b = append(b, `{"resourceLogs":[`...)
+	for i, resource := range resources {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, `{"resource":{"attributes":`...)
+		b = appendJSONAttributes(b, resource.attributes)
+		b = append(b, `},"scopeLogs":[{"scope":{"name":`...)
+		b = appendJsonString(b, w.options.scope)
+		b = append(b, `},"logRecords":[`...)
+		for j, record := range resource.records {
+			if j > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONLogRecord(b, record)
+		}
+		b = append(b, "]}]}"...)
+	}
+	return append(b, "]}"...)
+}
+
+func appendJSONLogRecord(b []byte, record otlpLogRecord) []byte {
+	b = append(b, `{"timeUnixNano":"`...)
+	b = strconv.AppendUint(b, record.timeUnixNano, 10)
+	b = append(b, `","observedTimeUnixNano":"`...)
+	b = strconv.AppendUint(b, record.observedTimeUnixNano, 10)
+	b = append(b, `","severityNumber":`...)
+	b = strconv.AppendInt(b, int64(record.severityNumber), 10)
+	b = append(b, `,"severityText":`...)
+	b = appendJsonString(b, record.severityText)
+	if record.body != "" {
+		b = append(b, `,"body":`...)
+		b = appendJSONValue(b, record.body)
+	}
+	b = append(b, `,"attributes":`...)
+	b = appendJSONAttributes(b, record.attributes)
+	if record.traceID != nil {
+		// OTLP/JSON uses hex encoding of trace context instead of base64
+		b = append(b, `,"traceId":"`...)
+		b = hex.AppendEncode(b, record.traceID)
+		b = append(b, '"')
+	}
+	if record.spanID != nil {
+		b = append(b, `,"spanId":"`...)
+		b = hex.AppendEncode(b, record.spanID)
+		b = append(b, '"')
+	}
+	return append(b, '}')
+}
+
+func appendJSONAttributes(b []byte, attributes []otlpKeyValue) []byte {
+	b = append(b, '[')
+	for i, attr := range attributes {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, `{"key":`...)
+		b = appendJsonString(b, attr.key)
+		b = append(b, `,"value":`...)
+		b = appendJSONValue(b, attr.value)
+		b = append(b, '}')
+	}
+	return append(b, ']')
+}
+
+// appendJSONValue encodes AnyValue
+func appendJSONValue(b []byte, value any) []byte {
+	switch value := value.(type) {
+	case string:
+		b = append(b, `{"stringValue":`...)
+		b = appendJsonString(b, value)
+	case bool:
+		b = append(b, `{"boolValue":`...)
+		b = strconv.AppendBool(b, value)
+	case int64:
+		// 64-bit integers are encoded as strings in OTLP/JSON
+		b = append(b, `{"intValue":"`...)
+		b = strconv.AppendInt(b, value, 10)
+		b = append(b, '"')
+	case float64:
+		b = append(b, `{"doubleValue":`...)
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			b = appendJsonString(b, strconv.FormatFloat(value, 'g', -1, 64))
+		} else {
+			b = strconv.AppendFloat(b, value, 'g', -1, 64)
+		}
+	case []any:
+		b = append(b, `{"arrayValue":{"values":[`...)
+		for i, item := range value {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONValue(b, item)
+		}
+		b = append(b, "]}"...)
+	case []otlpKeyValue:
+		b = append(b, `{"kvlistValue":{"values":`...)
+		b = appendJSONAttributes(b, value)
+		b = append(b, '}')
+	default:
+		return append(b, "{}"...)
+	}
+	return append(b, '}')
+}
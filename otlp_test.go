@@ -0,0 +1,271 @@
+package ecslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oidq/ecslog/internal/protowire"
+)
+
+// fakeCollector stores bodies of OTLP/HTTP requests, statuses are returned to the first requests
+type fakeCollector struct {
+	mu           sync.Mutex
+	contentTypes []string
+	bodies       [][]byte
+	statuses     []int
+}
+
+func (c *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.contentTypes = append(c.contentTypes, r.Header.Get("Content-Type"))
+	c.bodies = append(c.bodies, body)
+	if len(c.bodies) <= len(c.statuses) {
+		w.WriteHeader(c.statuses[len(c.bodies)-1])
+	}
+}
+
+func logOTLPTestRecords(t *testing.T, w *OTLPWriter) {
+	h := NewHandler(w).WithAttrs([]slog.Attr{
+		slog.String("service.name", "checkout"),
+		slog.String("host.hostname", "node-1"),
+	})
+
+	r := slog.NewRecord(time.Unix(1768150842, 426480000), slog.LevelWarn, "Hello World", 0)
+	r.AddAttrs(
+		slog.String("trace.id", "4bf92f3577b34da6a3ce929d0e0e4736"),
+		slog.String("span.id", "00f067aa0ba902b7"),
+		slog.String("event.action", "test"),
+		slog.Int("http.response.status_code", 503),
+		slog.Any("tags", []string{"a", "b"}),
+	)
+	if err := h.Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOTLPWriter_JSON(t *testing.T) {
+	collector := &fakeCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	w := NewOTLPWriter(server.URL+"/v1/logs", WithOTLPProtocol(OTLPJSON))
+	logOTLPTestRecords(t, w)
+
+	if len(collector.bodies) != 1 || collector.contentTypes[0] != "application/json" {
+		t.Fatalf("unexpected requests: %v", collector.contentTypes)
+	}
+
+	var request struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []any `json:"attributes"`
+			} `json:"resource"`
+			ScopeLogs []struct {
+				LogRecords []map[string]any `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	if err := json.Unmarshal(collector.bodies[0], &request); err != nil {
+		t.Fatalf("invalid request: %s\n%s", err, collector.bodies[0])
+	}
+
+	expectedResource := []any{
+		val{"key": "host.hostname", "value": val{"stringValue": "node-1"}},
+		val{"key": "service.name", "value": val{"stringValue": "checkout"}},
+	}
+	if !reflect.DeepEqual(request.ResourceLogs[0].Resource.Attributes, expectedResource) {
+		t.Errorf("mismatched resource\nEXP: %#v\nGOT: %#v", expectedResource, request.ResourceLogs[0].Resource.Attributes)
+	}
+
+	record := request.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	delete(record, "observedTimeUnixNano")
+	expectedRecord := val{
+		"timeUnixNano":   "1768150842426480000",
+		"severityNumber": float64(13),
+		"severityText":   "WARN",
+		"body":           val{"stringValue": "Hello World"},
+		"traceId":        "4bf92f3577b34da6a3ce929d0e0e4736",
+		"spanId":         "00f067aa0ba902b7",
+		"attributes": arr{
+			val{"key": "event.action", "value": val{"stringValue": "test"}},
+			val{"key": "http.response.status_code", "value": val{"intValue": "503"}},
+			val{"key": "tags", "value": val{"arrayValue": val{"values": arr{
+				val{"stringValue": "a"},
+				val{"stringValue": "b"},
+			}}}},
+		},
+	}
+	if !reflect.DeepEqual(record, expectedRecord) {
+		t.Errorf("mismatched record\nEXP: %#v\nGOT: %#v", expectedRecord, record)
+	}
+}
+
+type protoField struct {
+	value uint64
+	data  []byte
+}
+
+func decodeProtoFields(t *testing.T, b []byte) map[int][]protoField {
+	t.Helper()
+
+	fields := make(map[int][]protoField)
+	for len(b) > 0 {
+		num, _, value, data, n, err := protowire.ConsumeField(b)
+		if err != nil {
+			t.Fatalf("invalid protobuf: %s", err)
+		}
+		fields[num] = append(fields[num], protoField{value: value, data: data})
+		b = b[n:]
+	}
+	return fields
+}
+
+func TestOTLPWriter_Protobuf(t *testing.T) {
+	collector := &fakeCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	w := NewOTLPWriter(server.URL + "/v1/logs")
+	logOTLPTestRecords(t, w)
+
+	if len(collector.bodies) != 1 || collector.contentTypes[0] != "application/x-protobuf" {
+		t.Fatalf("unexpected requests: %v", collector.contentTypes)
+	}
+
+	// ExportLogsServiceRequest -> ResourceLogs -> ScopeLogs -> LogRecord
+	resourceLogs := decodeProtoFields(t, decodeProtoFields(t, collector.bodies[0])[1][0].data)
+	resource := decodeProtoFields(t, resourceLogs[1][0].data)
+	if len(resource[1]) != 2 {
+		t.Errorf("expected 2 resource attributes, got %d", len(resource[1]))
+	}
+	scopeLogs := decodeProtoFields(t, resourceLogs[2][0].data)
+	scope := decodeProtoFields(t, scopeLogs[1][0].data)
+	if string(scope[1][0].data) != "github.com/oidq/ecslog" {
+		t.Errorf("unexpected scope: %s", scope[1][0].data)
+	}
+
+	record := decodeProtoFields(t, scopeLogs[2][0].data)
+	if record[1][0].value != 1768150842426480000 {
+		t.Errorf("unexpected time: %d", record[1][0].value)
+	}
+	if record[2][0].value != 13 || string(record[3][0].data) != "WARN" {
+		t.Errorf("unexpected severity: %d %s", record[2][0].value, record[3][0].data)
+	}
+	body := decodeProtoFields(t, record[5][0].data)
+	if string(body[1][0].data) != "Hello World" {
+		t.Errorf("unexpected body: %s", body[1][0].data)
+	}
+	if len(record[6]) != 3 {
+		t.Errorf("expected 3 attributes, got %d", len(record[6]))
+	}
+	statusAttr := decodeProtoFields(t, record[6][1].data)
+	statusValue := decodeProtoFields(t, statusAttr[2][0].data)
+	if string(statusAttr[1][0].data) != "http.response.status_code" || statusValue[3][0].value != 503 {
+		t.Errorf("unexpected attribute: %s=%d", statusAttr[1][0].data, statusValue[3][0].value)
+	}
+	if len(record[9][0].data) != 16 || len(record[10][0].data) != 8 {
+		t.Errorf("unexpected trace context: %x %x", record[9][0].data, record[10][0].data)
+	}
+}
+
+func TestOTLPWriter_Retry(t *testing.T) {
+	collector := &fakeCollector{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	w := NewOTLPWriter(server.URL+"/v1/logs", WithOTLPRetries(2, time.Millisecond, time.Millisecond))
+	logOTLPTestRecords(t, w)
+
+	if len(collector.bodies) != 3 || w.Dropped() != 0 {
+		t.Errorf("expected 3 requests and no dropped records, got %d requests and %d dropped", len(collector.bodies), w.Dropped())
+	}
+}
+
+func TestOTLPWriter_Rejected(t *testing.T) {
+	collector := &fakeCollector{statuses: []int{http.StatusBadRequest}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	w := NewOTLPWriter(server.URL+"/v1/logs", WithOTLPBatch(512, time.Hour))
+	slog.New(NewHandler(w)).Info("rejected")
+
+	var rejected *RejectedError
+	if err := w.Close(context.Background()); !errors.As(err, &rejected) {
+		t.Errorf("expected rejected error, got %v", err)
+	}
+	if len(collector.bodies) != 1 || w.Dropped() != 1 {
+		t.Errorf("expected 1 request and 1 dropped record, got %d requests and %d dropped", len(collector.bodies), w.Dropped())
+	}
+}
+
+func TestOTLPWriter_BufferSize(t *testing.T) {
+	collector := &fakeCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	w := NewOTLPWriter(server.URL+"/v1/logs", WithOTLPBatch(512, time.Hour), WithOTLPBufferSize(2))
+	logger := slog.New(NewHandler(w))
+	for range 3 {
+		logger.Info("buffered")
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if w.Dropped() != 1 {
+		t.Errorf("expected 1 dropped record, got %d", w.Dropped())
+	}
+}
+
+func TestOTLPWriter_SpoolRetained(t *testing.T) {
+	collector := &fakeCollector{statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	out := NewOTLPWriter(server.URL+"/v1/logs",
+		WithOTLPProtocol(OTLPJSON),
+		WithOTLPBatch(1, time.Millisecond),
+		WithOTLPRetries(0, time.Millisecond, time.Millisecond),
+	)
+	defer func() { _ = out.Close(context.Background()) }()
+	s, err := NewSpoolWriter(t.TempDir(), out, WithSpoolBackoff(time.Millisecond, 5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSpoolLines(t, s, `{"message":"first"}`, `{"message":"second"}`)
+
+	// the failed exports are neither dropped by the background flush nor replayed by the spool
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if out.Dropped() != 0 {
+		t.Errorf("expected no dropped records, got %d", out.Dropped())
+	}
+	exported := string(bytes.Join(collector.bodies[len(collector.statuses):], nil))
+	for _, message := range []string{"first", "second"} {
+		if count := strings.Count(exported, `"`+message+`"`); count != 1 {
+			t.Errorf("expected %q to be exported once, got %d", message, count)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package ecslog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimitOverflowKey is used for the records with keys above the maximum number of tracked keys
+const rateLimitOverflowKey = "<other>"
+
+type rateLimitOptions struct {
+	key         string
+	rate        float64
+	burst       float64
+	globalRate  float64
+	globalBurst float64
+	window      time.Duration
+	maxKeys     int
+}
+
+// RateLimitOption configures [RateLimitHandler].
+type RateLimitOption func(*rateLimitOptions)
+
+// WithRateLimitKey sets the attribute whose value is used as the key of the rate limit
+// (e.g. "event.dataset"). The key "message" refers to the message of the record.
+// Default value is "message".
+func WithRateLimitKey(key string) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.key = key
+	}
+}
+
+// WithRateLimit sets the rate in records per second and the burst of the token bucket
+// of each key. Default values are 100 and 100.
+func WithRateLimit(perSecond float64, burst int) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.rate = perSecond
+		o.burst = float64(burst)
+	}
+}
+
+// WithRateLimitGlobal sets the rate in records per second and the burst of the token bucket
+// shared by all keys. The global limit is disabled by default.
+func WithRateLimitGlobal(perSecond float64, burst int) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.globalRate = perSecond
+		o.globalBurst = float64(burst)
+	}
+}
+
+// WithRateLimitWindow sets the window after which the summaries of suppressed records are logged.
+// Default value is 10s.
+func WithRateLimitWindow(window time.Duration) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.window = window
+	}
+}
+
+// WithRateLimitMaxKeys sets the maximum number of tracked keys. When the maximum is reached, idle keys
+// are forgotten, at most once per window, and records with other keys share a single token bucket.
+// Default value is 10000.
+func WithRateLimitMaxKeys(maxKeys int) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.maxKeys = maxKeys
+	}
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) allow(now time.Time, rate, burst float64) bool {
+	b.refill(now, rate, burst)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *tokenBucket) refill(now time.Time, rate, burst float64) {
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+}
+
+type rateLimitBucket struct {
+	tokenBucket
+	suppressed uint64
+}
+
+// rateLimiter holds the state shared by RateLimitHandler and its derived handlers
+type rateLimiter struct {
+	options rateLimitOptions
+	root    slog.Handler
+
+	mu        sync.Mutex
+	buckets   map[string]*rateLimitBucket
+	global    tokenBucket
+	timer     *time.Timer
+	lastEvict time.Time
+
+	suppressed atomic.Uint64
+}
+
+// allow reports whether the record with given key may be logged
+func (l *rateLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.options.maxKeys && now.Sub(l.lastEvict) >= l.options.window {
+			l.evictIdle(now)
+		}
+		if len(l.buckets) >= l.options.maxKeys {
+			key = rateLimitOverflowKey
+			bucket = l.buckets[key]
+		}
+		if bucket == nil {
+			bucket = &rateLimitBucket{}
+			l.buckets[key] = bucket
+		}
+	}
+
+	// the token of the key is taken only when the global bucket allows the record
+	bucket.refill(now, l.options.rate, l.options.burst)
+	if bucket.tokens >= 1 &&
+		(l.options.globalRate <= 0 || l.global.allow(now, l.options.globalRate, l.options.globalBurst)) {
+		bucket.tokens--
+		return true
+	}
+
+	bucket.suppressed++
+	l.suppressed.Add(1)
+	if l.timer == nil {
+		l.timer = time.AfterFunc(l.options.window, func() {
+			_ = l.flush(context.Background())
+		})
+	}
+	return false
+}
+
+// flush logs the summaries of suppressed records and forgets idle keys
+func (l *rateLimiter) flush(ctx context.Context) error {
+	type summary struct {
+		key        string
+		suppressed uint64
+	}
+	var summaries []summary
+
+	l.mu.Lock()
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	now := time.Now()
+	l.evictIdle(now)
+	for key, bucket := range l.buckets {
+		if bucket.suppressed > 0 {
+			summaries = append(summaries, summary{key: key, suppressed: bucket.suppressed})
+			bucket.suppressed = 0
+		}
+	}
+	l.mu.Unlock()
+
+	slices.SortFunc(summaries, func(a, b summary) int {
+		return strings.Compare(a.key, b.key)
+	})
+
+	if !l.root.Enabled(ctx, slog.LevelWarn) {
+		return nil
+	}
+	var err error
+	for _, s := range summaries {
+		record := slog.NewRecord(now, slog.LevelWarn,
+			fmt.Sprintf("suppressed %d records for key %q", s.suppressed, s.key), 0)
+		record.AddAttrs(
+			slog.String("event.kind", "metric"),
+			slog.String("event.action", "log-records-suppressed"),
+			// ECS labels are keywords, so the count is a string
+			slog.String("labels.suppressed_records", strconv.FormatUint(s.suppressed, 10)),
+			slog.String("labels.rate_limit_key", s.key),
+		)
+		if handleErr := l.root.Handle(ctx, record); handleErr != nil && err == nil {
+			err = handleErr
+		}
+	}
+	return err
+}
+
+// evictIdle forgets the keys with full buckets and no suppressed records, it must be called with l.mu held
+func (l *rateLimiter) evictIdle(now time.Time) {
+	for key, bucket := range l.buckets {
+		if bucket.suppressed > 0 {
+			continue
+		}
+		if bucket.refill(now, l.options.rate, l.options.burst); bucket.tokens >= l.options.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastEvict = now
+}
+
+// RateLimitHandler is [slog.Handler] wrapper which limits the rate of records using token buckets.
+// Each value of the key attribute (e.g. "event.dataset" or the message) has its own bucket, and
+// optionally all records share a global bucket. Records exceeding the limit are suppressed.
+//
+// When records are suppressed, a single summary record is logged for each key when the window
+// closes, e.g. `suppressed 12345 records for key "X"`, with level WARN, "event.kind":"metric",
+// "labels.suppressed_records" and "labels.rate_limit_key" fields.
+type RateLimitHandler struct {
+	next    slog.Handler
+	limiter *rateLimiter
+
+	attrPrefix string
+	key        string
+}
+
+// NewRateLimitHandler creates a new [RateLimitHandler] passing the records within limits to next.
+func NewRateLimitHandler(next slog.Handler, options ...RateLimitOption) *RateLimitHandler {
+	l := &rateLimiter{
+		options: rateLimitOptions{
+			key:     "message",
+			rate:    100,
+			burst:   100,
+			window:  10 * time.Second,
+			maxKeys: 10000,
+		},
+		root:    next,
+		buckets: make(map[string]*rateLimitBucket),
+	}
+	for _, option := range options {
+		option(&l.options)
+	}
+
+	return &RateLimitHandler{
+		next:    next,
+		limiter: l,
+	}
+}
+
+// Suppressed returns the total number of suppressed records.
+func (h *RateLimitHandler) Suppressed() uint64 {
+	return h.limiter.suppressed.Load()
+}
+
+// Flush logs the summaries of records suppressed in the current window immediately.
+func (h *RateLimitHandler) Flush(ctx context.Context) error {
+	return h.limiter.flush(ctx)
+}
+
+// Enabled reports whether the next handler handles records at given level.
+func (h *RateLimitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle passes the record to the next handler, unless it exceeds the limits.
+func (h *RateLimitHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handleWithAttrs(ctx, record, nil)
+}
+
+func (h *RateLimitHandler) handleWithAttrs(ctx context.Context, record slog.Record, attrs []slog.Attr) error {
+	key := h.key
+	if h.limiter.options.key == "message" {
+		key = record.Message
+	} else {
+		record.Attrs(func(attr slog.Attr) bool {
+			if value, ok := findAttrValue(attr, h.attrPrefix, h.limiter.options.key); ok {
+				key = value.String()
+			}
+			return true
+		})
+	}
+
+	if !h.limiter.allow(key) {
+		return nil
+	}
+	return handleWithAttrs(ctx, h.next, record, attrs)
+}
+
+// WithAttrs creates new [RateLimitHandler] sharing the limits with h.
+func (h *RateLimitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	derived := *h
+	derived.next = h.next.WithAttrs(attrs)
+	for _, attr := range attrs {
+		if value, ok := findAttrValue(attr, h.attrPrefix, h.limiter.options.key); ok {
+			derived.key = value.String()
+		}
+	}
+	return &derived
+}
+
+// WithGroup creates new [RateLimitHandler] sharing the limits with h.
+func (h *RateLimitHandler) WithGroup(name string) slog.Handler {
+	derived := *h
+	derived.next = h.next.WithGroup(name)
+	derived.attrPrefix = h.attrPrefix + name + "."
+	return &derived
+}
@@ -0,0 +1,143 @@
+package ecslog
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func TestRateLimitHandler(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		buff := &syncBuffer{}
+		h := NewRateLimitHandler(NewHandler(buff, WithTimestamp(false)),
+			WithRateLimitKey("event.dataset"),
+			WithRateLimit(1, 2),
+			WithRateLimitWindow(time.Minute),
+		)
+		logger := slog.New(h)
+
+		audit := logger.With("event.dataset", "audit")
+		for range 5 {
+			audit.Info("audit")
+		}
+		for range 3 {
+			logger.Info("access", slog.Group("event", slog.String("dataset", "access")))
+		}
+		time.Sleep(time.Minute)
+		synctest.Wait()
+
+		// the buckets were refilled
+		audit.Info("audit")
+
+		expected := []map[string]interface{}{
+			{"log": val{"level": "INFO"}, "message": "audit", "event": val{"dataset": "audit"}},
+			{"log": val{"level": "INFO"}, "message": "audit", "event": val{"dataset": "audit"}},
+			{"log": val{"level": "INFO"}, "message": "access", "event": val{"dataset": "access"}},
+			{"log": val{"level": "INFO"}, "message": "access", "event": val{"dataset": "access"}},
+			{
+				"log":     val{"level": "WARN"},
+				"message": `suppressed 1 records for key "access"`,
+				"event":   val{"kind": "metric", "action": "log-records-suppressed"},
+				"labels":  val{"suppressed_records": "1", "rate_limit_key": "access"},
+			},
+			{
+				"log":     val{"level": "WARN"},
+				"message": `suppressed 3 records for key "audit"`,
+				"event":   val{"kind": "metric", "action": "log-records-suppressed"},
+				"labels":  val{"suppressed_records": "3", "rate_limit_key": "audit"},
+			},
+			{"log": val{"level": "INFO"}, "message": "audit", "event": val{"dataset": "audit"}},
+		}
+		if output := unmarshalLogs(t, &buff.buff); !reflect.DeepEqual(output, expected) {
+			t.Errorf("mismatched output\nEXP: %v\nGOT: %v", expected, output)
+		}
+		if h.Suppressed() != 4 {
+			t.Errorf("expected 4 suppressed records, got %d", h.Suppressed())
+		}
+	})
+}
+
+func TestRateLimitHandler_Global(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		buff := &syncBuffer{}
+		h := NewRateLimitHandler(NewHandler(buff, WithTimestamp(false)),
+			WithRateLimit(100, 100),
+			WithRateLimitGlobal(1, 3),
+		)
+		logger := slog.New(h)
+
+		for _, msg := range []string{"a", "b", "c", "d", "a"} {
+			logger.Info(msg)
+		}
+		if err := h.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		var messages []any
+		for _, line := range unmarshalLogs(t, &buff.buff) {
+			messages = append(messages, line["message"])
+		}
+		expected := []any{"a", "b", "c", `suppressed 1 records for key "a"`, `suppressed 1 records for key "d"`}
+		if !reflect.DeepEqual(messages, expected) {
+			t.Errorf("mismatched messages\nEXP: %v\nGOT: %v", expected, messages)
+		}
+	})
+}
+
+func TestRateLimitHandler_GlobalDenied(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		buff := &syncBuffer{}
+		h := NewRateLimitHandler(NewHandler(buff, WithTimestamp(false)),
+			WithRateLimit(0.5, 1),
+			WithRateLimitGlobal(1, 1),
+		)
+		logger := slog.New(h)
+
+		logger.Info("a")
+		// suppressed by the global bucket, the token of the key is kept
+		logger.Info("b")
+		time.Sleep(time.Second)
+		logger.Info("b")
+
+		var messages []any
+		for _, line := range unmarshalLogs(t, &buff.buff) {
+			messages = append(messages, line["message"])
+		}
+		if expected := []any{"a", "b"}; !reflect.DeepEqual(messages, expected) {
+			t.Errorf("mismatched messages\nEXP: %v\nGOT: %v", expected, messages)
+		}
+	})
+}
+
+func TestRateLimitHandler_MaxKeys(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		buff := &syncBuffer{}
+		h := NewRateLimitHandler(NewHandler(buff, WithTimestamp(false)),
+			WithRateLimit(1, 1),
+			WithRateLimitMaxKeys(1),
+			WithRateLimitWindow(time.Second),
+		)
+		logger := slog.New(h)
+
+		logger.Info("a")
+		time.Sleep(2 * time.Second)
+		// the idle key is forgotten, so the new key gets its own bucket
+		logger.Info("b")
+		logger.Info("b")
+		if err := h.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		var messages []any
+		for _, line := range unmarshalLogs(t, &buff.buff) {
+			messages = append(messages, line["message"])
+		}
+		expected := []any{"a", "b", `suppressed 1 records for key "b"`}
+		if !reflect.DeepEqual(messages, expected) {
+			t.Errorf("mismatched messages\nEXP: %v\nGOT: %v", expected, messages)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package ecslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+)
+
+// decodeRecord decodes JSON line produced by Handler into nested maps,
+// which is used by writers translating records to other formats.
+// Numbers are decoded as [json.Number] to preserve integers.
+func decodeRecord(line []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+
+	var record map[string]any
+	if err := dec.Decode(&record); err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, errors.New("ecslog: record is not an object")
+	}
+	return record, nil
+}
+
+// lookupField returns the value of dotted key in the decoded record.
+func lookupField(record map[string]any, key string) (any, bool) {
+	var current any = record
+	for {
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+
+		name, rest, nested := strings.Cut(key, string(groupSeparator))
+		if !nested {
+			value, ok := obj[key]
+			return value, ok
+		}
+		current, key = obj[name], rest
+	}
+}
+
+// lookupString returns the value of dotted key in the decoded record if it is a string.
+func lookupString(record map[string]any, key string) string {
+	value, _ := lookupField(record, key)
+	s, _ := value.(string)
+	return s
+}
+
+// flattenRecord calls fn for each non-object value of the decoded record with its dotted key.
+// Keys are visited in sorted order to produce stable output.
+func flattenRecord(record map[string]any, prefix string, fn func(key string, value any)) {
+	keys := make([]string, 0, len(record))
+	for key := range record {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if nested, ok := record[key].(map[string]any); ok {
+			flattenRecord(nested, prefix+key+string(groupSeparator), fn)
+			continue
+		}
+		fn(prefix+key, record[key])
+	}
+}
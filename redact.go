@@ -0,0 +1,260 @@
+package ecslog
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+)
+
+// redactedValue replaces the values redacted by [RedactReplace]
+const redactedValue = "[REDACTED]"
+
+type redactAction int
+
+const (
+	redactRemove redactAction = iota
+	redactReplace
+	redactKeepLast
+	redactHMAC
+)
+
+// RedactionRule is a rule of [WithRedaction] option. It matches attributes by dotted key pattern
+// and applies single action on their values.
+//
+// The pattern is matched against the full key of the attribute including groups, the segments
+// are compared case-insensitively and "*" segment matches any number of segments. For example
+// "*.password" matches "password", "user.password" and "db.conn.password".
+type RedactionRule struct {
+	pattern  []string
+	action   redactAction
+	keepLast int
+	hmacKey  []byte
+}
+
+// RedactRemove creates [RedactionRule] removing the matching attributes.
+func RedactRemove(pattern string) RedactionRule {
+	return RedactionRule{pattern: strings.Split(pattern, "."), action: redactRemove}
+}
+
+// RedactReplace creates [RedactionRule] replacing the values of matching attributes with "[REDACTED]".
+func RedactReplace(pattern string) RedactionRule {
+	return RedactionRule{pattern: strings.Split(pattern, "."), action: redactReplace}
+}
+
+// RedactKeepLast creates [RedactionRule] replacing the values of matching attributes with "****"
+// followed by the last n characters of the value. Values not longer than n characters are replaced
+// with "****" only.
+func RedactKeepLast(pattern string, n int) RedactionRule {
+	return RedactionRule{pattern: strings.Split(pattern, "."), action: redactKeepLast, keepLast: max(n, 0)}
+}
+
+// RedactHMAC creates [RedactionRule] replacing the values of matching attributes with hex encoded
+// HMAC-SHA256 of the value with given key. Same values produce same hashes, so the records can be
+// still correlated by the value.
+func RedactHMAC(pattern string, key []byte) RedactionRule {
+	return RedactionRule{pattern: strings.Split(pattern, "."), action: redactHMAC, hmacKey: key}
+}
+
+// redactString applies the action of the rule on the string representation of the value
+func (r *RedactionRule) redactString(s string) string {
+	switch r.action {
+	case redactKeepLast:
+		if utf8.RuneCountInString(s) <= r.keepLast {
+			return "****"
+		}
+		i := len(s)
+		for range r.keepLast {
+			_, size := utf8.DecodeLastRuneInString(s[:i])
+			i -= size
+		}
+		return "****" + s[i:]
+	case redactHMAC:
+		mac := hmac.New(sha256.New, r.hmacKey)
+		_, _ = mac.Write([]byte(s))
+		return hex.EncodeToString(mac.Sum(nil))
+	default:
+		return redactedValue
+	}
+}
+
+// matchRedactPattern reports whether dotted key matches the pattern. If below is set,
+// it reports whether the pattern may match any descendant of the key instead.
+func matchRedactPattern(pattern []string, key string, below bool) bool {
+	if key == "" {
+		// all segments of the key were consumed
+		if below {
+			return len(pattern) > 0
+		}
+		for _, segment := range pattern {
+			if segment != "*" {
+				return false
+			}
+		}
+		return true
+	}
+	if len(pattern) == 0 {
+		return false
+	}
+
+	segment, rest, _ := strings.Cut(key, ".")
+	if pattern[0] == "*" {
+		return matchRedactPattern(pattern[1:], key, below) || matchRedactPattern(pattern, rest, below)
+	}
+	return strings.EqualFold(pattern[0], segment) && matchRedactPattern(pattern[1:], rest, below)
+}
+
+// redactor applies the redaction rules on attributes
+type redactor struct {
+	rules []RedactionRule
+}
+
+// match returns the first rule matching the key
+func (r *redactor) match(key string) *RedactionRule {
+	for i := range r.rules {
+		if matchRedactPattern(r.rules[i].pattern, key, false) {
+			return &r.rules[i]
+		}
+	}
+	return nil
+}
+
+func (r *redactor) mayMatchBelow(key string) bool {
+	for i := range r.rules {
+		if matchRedactPattern(r.rules[i].pattern, key, true) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinRedactKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	if key == "" {
+		return prefix
+	}
+	return prefix + "." + key
+}
+
+// redactAttr applies the rules on attribute with given full key. Removed attribute is returned
+// as empty attribute, which is ignored by Handler.
+func (r *redactor) redactAttr(key string, attr slog.Attr) (slog.Attr, bool) {
+	if rule := r.match(key); rule != nil {
+		if rule.action == redactRemove {
+			return slog.Attr{}, true
+		}
+		attr.Value = slog.StringValue(rule.redactString(redactValueString(attr.Value.Resolve())))
+		return attr, true
+	}
+
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		group := value.Group()
+		var redacted []slog.Attr
+		for i, groupAttr := range group {
+			groupAttr, changed := r.redactAttr(joinRedactKey(key, groupAttr.Key), groupAttr)
+			if changed && redacted == nil {
+				// copy the group on first change, so the original is not modified
+				redacted = append(make([]slog.Attr, 0, len(group)), group[:i]...)
+			}
+			if redacted != nil && !groupAttr.Equal(slog.Attr{}) {
+				redacted = append(redacted, groupAttr)
+			}
+		}
+		if redacted != nil {
+			attr.Value = slog.GroupValue(redacted...)
+			return attr, true
+		}
+
+	case slog.KindAny:
+		if _, ok := value.Any().(preformattedValue); ok || !r.mayMatchBelow(key) {
+			break
+		}
+		if redacted, ok := r.redactJSON(key, value); ok {
+			attr.Value = redacted
+			return attr, true
+		}
+	}
+	return attr, false
+}
+
+// redactJSON applies the rules on the marshalled value, the redacted value is returned preformatted
+func (r *redactor) redactJSON(key string, value slog.Value) (slog.Value, bool) {
+	encoded := appendJsonValue(nil, value)
+	if len(encoded) == 0 || (encoded[0] != '{' && encoded[0] != '[') {
+		return value, false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(encoded))
+	dec.UseNumber()
+	var decoded any
+	if err := dec.Decode(&decoded); err != nil {
+		return value, false
+	}
+
+	decoded, changed := r.redactDecoded(key, decoded)
+	if !changed {
+		return value, false
+	}
+	return slog.AnyValue(preformattedValue{value: appendJsonAny(nil, decoded), original: slog.AnyValue(decoded)}), true
+}
+
+// redactDecoded applies the rules on value decoded from JSON, the items of arrays share the key
+// of the array
+func (r *redactor) redactDecoded(key string, value any) (any, bool) {
+	changed := false
+	switch value := value.(type) {
+	case map[string]any:
+		for name, item := range value {
+			itemKey := joinRedactKey(key, name)
+			if rule := r.match(itemKey); rule != nil {
+				if rule.action == redactRemove {
+					delete(value, name)
+				} else {
+					value[name] = rule.redactString(decodedValueString(item))
+				}
+				changed = true
+				continue
+			}
+			if item, itemChanged := r.redactDecoded(itemKey, item); itemChanged {
+				value[name] = item
+				changed = true
+			}
+		}
+	case []any:
+		for i, item := range value {
+			if item, itemChanged := r.redactDecoded(key, item); itemChanged {
+				value[i] = item
+				changed = true
+			}
+		}
+	}
+	return value, changed
+}
+
+// redactValueString returns the string value or JSON representation of other values
+func redactValueString(value slog.Value) string {
+	if value.Kind() == slog.KindString {
+		return value.String()
+	}
+	return string(appendJsonValue(nil, value))
+}
+
+// decodedValueString returns the string value or JSON representation of other decoded values
+func decodedValueString(value any) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	default:
+		return string(appendJsonAny(nil, value))
+	}
+}
@@ -0,0 +1,140 @@
+package ecslog
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+type redactTestUser struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func redactTestHMAC(value string) string {
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+var redactionTestData = []struct {
+	name     string
+	with     []slog.Attr
+	attrs    []slog.Attr
+	expected map[string]interface{}
+}{
+	{
+		"Remove",
+		nil,
+		[]slog.Attr{slog.String("user.password", "pass"), slog.String("user.name", "john")},
+		val{"user": val{"name": "john"}},
+	},
+	{
+		"RemoveTopLevel",
+		nil,
+		[]slog.Attr{slog.String("password", "pass")},
+		val{},
+	},
+	{
+		"Replace",
+		nil,
+		[]slog.Attr{slog.String("http.request.headers.authorization", "Bearer token")},
+		val{"http": val{"request": val{"headers": val{"authorization": "[REDACTED]"}}}},
+	},
+	{
+		"ReplaceCaseInsensitive",
+		nil,
+		[]slog.Attr{slog.Group("http", slog.Group("request", slog.Group("headers", slog.String("Authorization", "Bearer token"))))},
+		val{"http": val{"request": val{"headers": val{"Authorization": "[REDACTED]"}}}},
+	},
+	{
+		"KeepLast",
+		nil,
+		[]slog.Attr{slog.String("card.number", "4111111111111111"), slog.String("card.cvc", "12")},
+		val{"card": val{"number": "****1111", "cvc": "****"}},
+	},
+	{
+		"HMAC",
+		nil,
+		[]slog.Attr{slog.String("user.email", "john@example.com")},
+		val{"user": val{"email": redactTestHMAC("john@example.com")}},
+	},
+	{
+		"Group",
+		nil,
+		[]slog.Attr{slog.Group("db", slog.Group("conn", slog.String("password", "pass"), slog.String("user", "app")))},
+		val{"db": val{"conn": val{"user": "app"}}},
+	},
+	{
+		"WithAttrsGroup",
+		[]slog.Attr{slog.Group("db", slog.String("password", "pass"), slog.String("user", "app"))},
+		nil,
+		val{"db": val{"user": "app"}},
+	},
+	{
+		"WithAttrsString",
+		[]slog.Attr{slog.String("user.email", "john@example.com")},
+		nil,
+		val{"user": val{"email": redactTestHMAC("john@example.com")}},
+	},
+	{
+		"Struct",
+		nil,
+		[]slog.Attr{slog.Any("user", redactTestUser{Name: "john", Email: "john@example.com", Password: "pass"})},
+		val{"user": val{"name": "john", "email": redactTestHMAC("john@example.com")}},
+	},
+	{
+		"WithAttrsStruct",
+		[]slog.Attr{slog.Any("user", redactTestUser{Name: "john", Password: "pass"})},
+		nil,
+		val{"user": val{"name": "john", "email": redactTestHMAC("")}},
+	},
+	{
+		"Map",
+		nil,
+		[]slog.Attr{slog.Any("accounts", []map[string]any{{"id": 1, "password": "pass"}})},
+		val{"accounts": arr{val{"id": float64(1)}}},
+	},
+}
+
+func TestWithRedaction(t *testing.T) {
+	for _, data := range redactionTestData {
+		t.Run(data.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			h := NewHandler(buff, WithTimestamp(false), WithRedaction(
+				RedactRemove("*.password"),
+				RedactReplace("http.request.headers.authorization"),
+				RedactKeepLast("card.*", 4),
+				RedactHMAC("user.email", []byte("secret")),
+			))
+
+			var logger slog.Handler = h
+			if data.with != nil {
+				logger = h.WithAttrs(data.with)
+			}
+			slog.New(logger).LogAttrs(t.Context(), slog.LevelInfo, "", data.attrs...)
+
+			expected := data.expected
+			expected["log"] = val{"level": "INFO"}
+			output := unmarshalLogs(t, buff)
+			if len(output) != 1 || !reflect.DeepEqual(output[0], expected) {
+				t.Errorf("mismatched output\nEXP: %v\nGOT: %v", expected, output)
+			}
+		})
+	}
+}
+
+func TestWithRedaction_Unmodified(t *testing.T) {
+	group := []slog.Attr{slog.String("password", "pass")}
+	h := NewHandler(&bytes.Buffer{}, WithRedaction(RedactRemove("*.password")))
+	slog.New(h).Info("", slog.Any("db", slog.GroupValue(group...)))
+
+	if group[0].Value.String() != "pass" {
+		t.Errorf("expected group of the caller to be unmodified, got %v", group)
+	}
+}
@@ -0,0 +1,401 @@
+package ecslog
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotateTimeFormat is used in names of rotated files, it avoids colons to be usable on all platforms
+const rotateTimeFormat = "2006-01-02T15-04-05.000"
+
+const compressSuffix = ".gz"
+
+type rotateOptions struct {
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	maxAge     time.Duration
+	compress   bool
+	sighup     bool
+}
+
+// RotateOption configures [RotatingFile].
+type RotateOption func(*rotateOptions)
+
+// WithRotateMaxSize sets the size in bytes after which the file is rotated.
+// Zero value (default) disables the size based rotation.
+func WithRotateMaxSize(size int64) RotateOption {
+	return func(o *rotateOptions) {
+		o.maxSize = size
+	}
+}
+
+// WithRotateInterval sets the period of time based rotation. The file is rotated
+// on first write after each multiple of interval since zero time (e.g. at midnight UTC for 24h).
+// Zero value (default) disables the time based rotation.
+func WithRotateInterval(interval time.Duration) RotateOption {
+	return func(o *rotateOptions) {
+		o.interval = interval
+	}
+}
+
+// WithRotateMaxBackups sets the maximum number of rotated files to retain.
+// Zero value (default) retains all of them.
+func WithRotateMaxBackups(count int) RotateOption {
+	return func(o *rotateOptions) {
+		o.maxBackups = count
+	}
+}
+
+// WithRotateMaxAge sets the maximum age of rotated files to retain, based on the timestamp
+// in their name. Zero value (default) retains all of them.
+func WithRotateMaxAge(age time.Duration) RotateOption {
+	return func(o *rotateOptions) {
+		o.maxAge = age
+	}
+}
+
+// WithRotateCompress option can be used to gzip rotated files.
+func WithRotateCompress(compress bool) RotateOption {
+	return func(o *rotateOptions) {
+		o.compress = compress
+	}
+}
+
+// WithRotateReopenOnSIGHUP option can be used to reopen the file whenever the process
+// receives SIGHUP. It is useful when the file is moved by external tool.
+// The option has no effect on platforms without SIGHUP.
+func WithRotateReopenOnSIGHUP(reopen bool) RotateOption {
+	return func(o *rotateOptions) {
+		o.sighup = reopen
+	}
+}
+
+// RotatingFile is an [io.Writer] which writes to a file and rotates it based on its size and/or time.
+//
+// The rotated file is renamed to "<name>-<timestamp><ext>" (e.g. "app-2026-01-11T17-00-42.426.log")
+// in the same directory, optionally compressed and removed according to retention options.
+// Compression and retention are done on a background goroutine.
+//
+// Each Write call is written to a single file, so lines produced by [Handler.Handle]
+// (or batches produced by [AsyncWriter]) are never split across rotation boundaries.
+type RotatingFile struct {
+	path    string
+	options rotateOptions
+
+	mu           sync.Mutex
+	file         *os.File
+	size         int64
+	nextRotation time.Time
+	closed       bool
+
+	signals chan os.Signal
+
+	mill     chan struct{}
+	millDone chan struct{}
+	millErr  error
+}
+
+// NewRotatingFile opens (or creates) a file with given path for appending and returns [RotatingFile]
+// writing to it. It should be closed by [RotatingFile.Close].
+func NewRotatingFile(path string, options ...RotateOption) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:     path,
+		mill:     make(chan struct{}, 1),
+		millDone: make(chan struct{}),
+	}
+	for _, option := range options {
+		option(&f.options)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	go f.runMill()
+
+	if f.options.sighup {
+		signals := make(chan os.Signal, 1)
+		if notifySIGHUP(signals) {
+			f.signals = signals
+			go f.handleSignals(signals)
+		}
+	}
+
+	return f, nil
+}
+
+// Write writes p to the current file. The file is rotated beforehand, if p would
+// exceed the maximum size or the rotation interval has elapsed.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+
+	if f.shouldRotate(len(p)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the current file regardless of its size and time.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	return f.rotate()
+}
+
+// Reopen closes and opens the file again. It is used when the file has been moved
+// by an external tool.
+func (f *RotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Close closes the current file and waits for the background compression and retention.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return ErrClosed
+	}
+	f.closed = true
+	err := f.file.Close()
+	f.mu.Unlock()
+
+	if f.signals != nil {
+		signal.Stop(f.signals)
+		close(f.signals)
+	}
+
+	close(f.mill)
+	<-f.millDone
+
+	return errors.Join(err, f.millErr)
+}
+
+func (f *RotatingFile) shouldRotate(writeLen int) bool {
+	if f.options.maxSize > 0 && f.size > 0 && f.size+int64(writeLen) > f.options.maxSize {
+		return true
+	}
+	return f.options.interval > 0 && !time.Now().Before(f.nextRotation)
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+
+	// existing file is rotated on the first write if it comes from previous interval
+	opened := time.Now()
+	if f.size > 0 {
+		opened = info.ModTime()
+	}
+	if f.options.interval > 0 {
+		f.nextRotation = opened.Truncate(f.options.interval).Add(f.options.interval)
+	}
+	return nil
+}
+
+// rotate must be called with f.mu held
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	// the file is opened again even if the rename fails, so the writing can continue
+	var renameErr error
+	if f.size > 0 {
+		renameErr = os.Rename(f.path, f.backupName(time.Now()))
+	}
+	if err := f.open(); err != nil {
+		return errors.Join(renameErr, err)
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	select {
+	case f.mill <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (f *RotatingFile) backupName(t time.Time) string {
+	dir, prefix, ext := f.nameParts()
+	t = t.UTC()
+	for {
+		name := filepath.Join(dir, prefix+t.Format(rotateTimeFormat)+ext)
+		_, errPlain := os.Lstat(name)
+		_, errCompressed := os.Lstat(name + compressSuffix)
+		if errors.Is(errPlain, os.ErrNotExist) && errors.Is(errCompressed, os.ErrNotExist) {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+func (f *RotatingFile) nameParts() (dir, prefix, ext string) {
+	dir, name := filepath.Split(f.path)
+	ext = filepath.Ext(name)
+	return dir, strings.TrimSuffix(name, ext) + "-", ext
+}
+
+func (f *RotatingFile) handleSignals(signals chan os.Signal) {
+	for range signals {
+		// the error is reported by the next Write
+		_ = f.Reopen()
+	}
+}
+
+type rotatedFile struct {
+	name       string
+	t          time.Time
+	compressed bool
+}
+
+func (f *RotatingFile) runMill() {
+	defer close(f.millDone)
+
+	for range f.mill {
+		if err := f.millOnce(); err != nil {
+			f.millErr = err
+		}
+	}
+}
+
+func (f *RotatingFile) millOnce() error {
+	files, err := f.rotatedFiles()
+	if err != nil {
+		return err
+	}
+
+	// files are sorted from the newest
+	var errs []error
+	now := time.Now()
+	for i, file := range files {
+		expired := f.options.maxBackups > 0 && i >= f.options.maxBackups ||
+			f.options.maxAge > 0 && now.Sub(file.t) > f.options.maxAge
+
+		if expired {
+			errs = append(errs, os.Remove(file.name))
+			continue
+		}
+		if f.options.compress && !file.compressed {
+			errs = append(errs, compressFile(file.name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (f *RotatingFile) rotatedFiles() ([]rotatedFile, error) {
+	dir, prefix, ext := f.nameParts()
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []rotatedFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		file := rotatedFile{name: filepath.Join(dir, name)}
+		name, file.compressed = strings.CutSuffix(name, compressSuffix)
+		timestamp, ok := strings.CutSuffix(name[len(prefix):], ext)
+		if !ok {
+			continue
+		}
+		file.t, err = time.Parse(rotateTimeFormat, timestamp)
+		if err != nil {
+			continue
+		}
+		files = append(files, file)
+	}
+
+	slices.SortFunc(files, func(a, b rotatedFile) int {
+		return b.t.Compare(a.t)
+	})
+	return files, nil
+}
+
+func compressFile(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	dst, err := os.OpenFile(name+compressSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(name + compressSuffix)
+		}
+	}()
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+
+	_ = src.Close()
+	return os.Remove(name)
+}
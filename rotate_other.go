@@ -0,0 +1,10 @@
+//go:build !unix
+
+package ecslog
+
+import "os"
+
+// notifySIGHUP is no-op on platforms without SIGHUP
+func notifySIGHUP(_ chan<- os.Signal) bool {
+	return false
+}
@@ -0,0 +1,171 @@
+package ecslog
+
+import (
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func readRotatedFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]string)
+	for _, entry := range entries {
+		f, err := os.Open(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var r io.Reader = f
+		if strings.HasSuffix(entry.Name(), compressSuffix) {
+			r, err = gzip.NewReader(f)
+			if err != nil {
+				t.Fatalf("invalid gzip file %s: %s", entry.Name(), err)
+			}
+		}
+		content, err := io.ReadAll(r)
+		_ = f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[entry.Name()] = string(content)
+	}
+	return files
+}
+
+func TestRotatingFile_Size(t *testing.T) {
+	dir := t.TempDir()
+	f, err := NewRotatingFile(filepath.Join(dir, "app.log"), WithRotateMaxSize(200))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecs := slog.New(NewHandler(f, WithTimestamp(false)))
+	for i := 0; i < 20; i++ {
+		ecs.Info("Hello World", slog.Int("event.sequence", i))
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := readRotatedFiles(t, dir)
+	if len(files) < 2 {
+		t.Fatalf("expected rotated files, got %v", files)
+	}
+
+	lines := 0
+	for name, content := range files {
+		if len(content) > 200 {
+			t.Errorf("file %s exceeds max size: %d", name, len(content))
+		}
+		lines += len(unmarshalLogs(t, strings.NewReader(content)))
+	}
+	if lines != 20 {
+		t.Errorf("expected 20 lines, got %d", lines)
+	}
+}
+
+func TestRotatingFile_CompressRetention(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	// stale rotated file, which should be removed due to its age
+	stale := filepath.Join(dir, "app-"+time.Now().Add(-48*time.Hour).UTC().Format(rotateTimeFormat)+".log")
+	if err := os.WriteFile(stale, []byte("stale\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewRotatingFile(path,
+		WithRotateCompress(true),
+		WithRotateMaxBackups(2),
+		WithRotateMaxAge(24*time.Hour),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"a\n", "b\n", "c\n", "d\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := readRotatedFiles(t, dir)
+	if len(files) != 3 {
+		t.Fatalf("expected active file and 2 backups, got %v", files)
+	}
+	for name, content := range files {
+		if name == "app.log" {
+			continue
+		}
+		if !strings.HasSuffix(name, ".log"+compressSuffix) {
+			t.Errorf("backup %s is not compressed", name)
+		}
+		if content != "c\n" && content != "d\n" {
+			t.Errorf("unexpected backup %s retained: %q", name, content)
+		}
+	}
+}
+
+func TestRotatingFile_Interval(t *testing.T) {
+	dir := t.TempDir()
+	synctest.Test(t, func(t *testing.T) {
+		f, err := NewRotatingFile(filepath.Join(dir, "app.log"), WithRotateInterval(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _ = f.Write([]byte("a\n"))
+		time.Sleep(time.Hour)
+		_, _ = f.Write([]byte("b\n"))
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	files := readRotatedFiles(t, dir)
+	if len(files) != 2 || files["app.log"] != "b\n" {
+		t.Errorf("unexpected files: %v", files)
+	}
+}
+
+func TestRotatingFile_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	f, err := NewRotatingFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	_, _ = f.Write([]byte("a\n"))
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("b\n"))
+
+	files := readRotatedFiles(t, dir)
+	if files["app.log"] != "b\n" || files["app.log.1"] != "a\n" {
+		t.Errorf("unexpected files: %v", files)
+	}
+}
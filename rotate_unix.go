@@ -0,0 +1,15 @@
+//go:build unix
+
+package ecslog
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifySIGHUP relays SIGHUP to c, it reports whether the signal is supported
+func notifySIGHUP(c chan<- os.Signal) bool {
+	signal.Notify(c, syscall.SIGHUP)
+	return true
+}
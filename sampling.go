@@ -0,0 +1,202 @@
+package ecslog
+
+import (
+	"context"
+	"hash/maphash"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// samplingTableSize is the number of counters used by [SamplingHandler]. Records with different
+// keys may share a counter, which only makes the sampling a little more aggressive.
+const samplingTableSize = 4096
+
+type samplingOptions struct {
+	interval    time.Duration
+	first       uint64
+	thereafter  uint64
+	exemptLevel slog.Level
+	hook        func(level slog.Level, msg string, dropped uint64)
+	addField    bool
+}
+
+// SamplingOption configures [SamplingHandler].
+type SamplingOption func(*samplingOptions)
+
+// WithSamplingInterval sets the interval after which the counters are reset.
+// Default value is 1s.
+func WithSamplingInterval(interval time.Duration) SamplingOption {
+	return func(o *samplingOptions) {
+		o.interval = interval
+	}
+}
+
+// WithSamplingFirst sets the number of records with the same level and message which are
+// always logged in each interval. Default value is 100.
+func WithSamplingFirst(first int) SamplingOption {
+	return func(o *samplingOptions) {
+		o.first = uint64(max(first, 0))
+	}
+}
+
+// WithSamplingThereafter sets that every Mth record after the first N is logged.
+// Value 0 drops all records after the first N. Default value is 100.
+func WithSamplingThereafter(thereafter int) SamplingOption {
+	return func(o *samplingOptions) {
+		o.thereafter = uint64(max(thereafter, 0))
+	}
+}
+
+// WithSamplingExemptLevel sets the minimum level of records which are never sampled.
+// Default value is slog.LevelError.
+func WithSamplingExemptLevel(level slog.Level) SamplingOption {
+	return func(o *samplingOptions) {
+		o.exemptLevel = level
+	}
+}
+
+// WithSamplingHook sets the function which receives the number of records dropped since the last
+// logged record with the same level and message. It is called before the record is logged and
+// must be safe for concurrent use.
+func WithSamplingHook(hook func(level slog.Level, msg string, dropped uint64)) SamplingOption {
+	return func(o *samplingOptions) {
+		o.hook = hook
+	}
+}
+
+// WithSamplingField option can be used to add "log.sampled" field with the number of records dropped
+// since the last logged record with the same level and message.
+func WithSamplingField(addField bool) SamplingOption {
+	return func(o *samplingOptions) {
+		o.addField = addField
+	}
+}
+
+type samplingCounter struct {
+	resetAt atomic.Int64
+	count   atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// inc increments the counter, resetting it when the interval elapsed
+func (c *samplingCounter) inc(t, interval int64) uint64 {
+	resetAt := c.resetAt.Load()
+	if resetAt > t {
+		return c.count.Add(1)
+	}
+
+	c.count.Store(1)
+	if !c.resetAt.CompareAndSwap(resetAt, t+interval) {
+		// other goroutine has reset the counter
+		return c.count.Add(1)
+	}
+	return 1
+}
+
+// sampler holds the state shared by SamplingHandler and its derived handlers
+type sampler struct {
+	options  samplingOptions
+	seed     maphash.Seed
+	counters [samplingTableSize]samplingCounter
+	dropped  atomic.Uint64
+}
+
+func (s *sampler) counter(level slog.Level, msg string) *samplingCounter {
+	hash := maphash.String(s.seed, msg) ^ uint64(int64(level))*0x9e3779b97f4a7c15
+	return &s.counters[hash%samplingTableSize]
+}
+
+// SamplingHandler is [slog.Handler] wrapper which limits the number of records with the same level
+// and message. In each interval, the first N records are logged and then every Mth, the rest is dropped.
+// Records with level at or above the exempt level are never dropped.
+//
+// The counters are kept in a fixed-size table without locking, so the memory and the overhead
+// do not grow with the number of distinct messages.
+type SamplingHandler struct {
+	next    slog.Handler
+	sampler *sampler
+}
+
+// NewSamplingHandler creates a new [SamplingHandler] passing the sampled records to next.
+func NewSamplingHandler(next slog.Handler, options ...SamplingOption) *SamplingHandler {
+	s := &sampler{
+		options: samplingOptions{
+			interval:    time.Second,
+			first:       100,
+			thereafter:  100,
+			exemptLevel: slog.LevelError,
+		},
+		seed: maphash.MakeSeed(),
+	}
+	for _, option := range options {
+		option(&s.options)
+	}
+
+	return &SamplingHandler{
+		next:    next,
+		sampler: s,
+	}
+}
+
+// Dropped returns the total number of dropped records.
+func (h *SamplingHandler) Dropped() uint64 {
+	return h.sampler.dropped.Load()
+}
+
+// Enabled reports whether the next handler handles records at given level.
+func (h *SamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle passes the record to the next handler, unless it is dropped by sampling.
+func (h *SamplingHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handleWithAttrs(ctx, record, nil)
+}
+
+func (h *SamplingHandler) handleWithAttrs(ctx context.Context, record slog.Record, attrs []slog.Attr) error {
+	s := h.sampler
+	if record.Level >= s.options.exemptLevel {
+		return handleWithAttrs(ctx, h.next, record, attrs)
+	}
+
+	t0 := record.Time
+	if t0.IsZero() {
+		t0 = time.Now()
+	}
+
+	c := s.counter(record.Level, record.Message)
+	n := c.inc(t0.UnixNano(), int64(s.options.interval))
+	if n > s.options.first && (s.options.thereafter == 0 || (n-s.options.first)%s.options.thereafter != 0) {
+		c.dropped.Add(1)
+		s.dropped.Add(1)
+		return nil
+	}
+
+	if dropped := c.dropped.Swap(0); dropped > 0 {
+		if s.options.hook != nil {
+			s.options.hook(record.Level, record.Message, dropped)
+		}
+		if s.options.addField {
+			// do not modify the slice of the caller
+			attrs = append(attrs[:len(attrs):len(attrs)], slog.Uint64("log.sampled", dropped))
+		}
+	}
+	return handleWithAttrs(ctx, h.next, record, attrs)
+}
+
+// WithAttrs creates new [SamplingHandler] sharing the counters with h.
+func (h *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &SamplingHandler{
+		next:    h.next.WithAttrs(attrs),
+		sampler: h.sampler,
+	}
+}
+
+// WithGroup creates new [SamplingHandler] sharing the counters with h.
+func (h *SamplingHandler) WithGroup(name string) slog.Handler {
+	return &SamplingHandler{
+		next:    h.next.WithGroup(name),
+		sampler: h.sampler,
+	}
+}
@@ -0,0 +1,88 @@
+package ecslog
+
+import (
+	"bytes"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func TestSamplingHandler(t *testing.T) {
+	buff := &bytes.Buffer{}
+
+	var mu sync.Mutex
+	var hooked []uint64
+	h := NewSamplingHandler(NewHandler(buff, WithTimestamp(false)),
+		WithSamplingFirst(2),
+		WithSamplingThereafter(3),
+		WithSamplingField(true),
+		WithSamplingHook(func(level slog.Level, msg string, dropped uint64) {
+			mu.Lock()
+			defer mu.Unlock()
+			hooked = append(hooked, dropped)
+		}),
+	)
+	logger := slog.New(h)
+
+	for i := range 10 {
+		logger.WithGroup("request").Info("Hello World", "id", i)
+		logger.Error("failed")
+	}
+	logger.Warn("other")
+
+	expected := []map[string]interface{}{
+		{"log": val{"level": "INFO"}, "message": "Hello World", "request": val{"id": float64(0)}},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+		{"log": val{"level": "INFO"}, "message": "Hello World", "request": val{"id": float64(1)}},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+		{"log": val{"level": "INFO", "sampled": float64(2)}, "message": "Hello World", "request": val{"id": float64(4)}},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+		{"log": val{"level": "INFO", "sampled": float64(2)}, "message": "Hello World", "request": val{"id": float64(7)}},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+		{"log": val{"level": "ERROR"}, "message": "failed"},
+		{"log": val{"level": "WARN"}, "message": "other"},
+	}
+	if output := unmarshalLogs(t, buff); !reflect.DeepEqual(output, expected) {
+		t.Errorf("mismatched output\nEXP: %v\nGOT: %v", expected, output)
+	}
+
+	if !reflect.DeepEqual(hooked, []uint64{2, 2}) {
+		t.Errorf("unexpected hook calls: %v", hooked)
+	}
+	if h.Dropped() != 6 {
+		t.Errorf("expected 6 dropped records, got %d", h.Dropped())
+	}
+}
+
+func TestSamplingHandler_Interval(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		buff := &bytes.Buffer{}
+		logger := slog.New(NewSamplingHandler(NewHandler(buff, WithTimestamp(false)),
+			WithSamplingFirst(1),
+			WithSamplingThereafter(0),
+			WithSamplingInterval(time.Second),
+		))
+
+		logger.Info("Hello World", "round", 1)
+		logger.Info("Hello World", "round", 1)
+		time.Sleep(time.Second)
+		logger.Info("Hello World", "round", 2)
+		logger.Info("Hello World", "round", 2)
+
+		expected := []map[string]interface{}{
+			{"log": val{"level": "INFO"}, "message": "Hello World", "round": float64(1)},
+			{"log": val{"level": "INFO"}, "message": "Hello World", "round": float64(2)},
+		}
+		if output := unmarshalLogs(t, buff); !reflect.DeepEqual(output, expected) {
+			t.Errorf("mismatched output\nEXP: %v\nGOT: %v", expected, output)
+		}
+	})
+}
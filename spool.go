@@ -0,0 +1,618 @@
+package ecslog
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSpoolFull is returned by [SpoolWriter.Write] when the spool reached its maximum size.
+var ErrSpoolFull = errors.New("ecslog: spool is full")
+
+// RejectedError is returned by the writers of this package when the destination permanently
+// rejected some of the records, e.g. Elasticsearch documents not matching the index mapping.
+// Such records would be rejected again, so [SpoolWriter] does not retry them.
+type RejectedError struct {
+	Err error
+}
+
+func (e *RejectedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// retainedError is returned by the flush of writers which keep the records they could not send
+// and retry them with the next flush, so the records must not be written to them again
+type retainedError struct {
+	err error
+}
+
+func (e retainedError) Error() string {
+	return e.err.Error()
+}
+
+func (e retainedError) Unwrap() error {
+	return e.err
+}
+
+// SpoolSync selects when [SpoolWriter] calls fsync on the spooled data.
+type SpoolSync int
+
+const (
+	// SpoolSyncInterval syncs the data periodically.
+	SpoolSyncInterval SpoolSync = iota
+	// SpoolSyncAlways syncs the data after each write.
+	SpoolSyncAlways
+	// SpoolSyncNever leaves the syncing to the operating system.
+	SpoolSyncNever
+)
+
+const (
+	spoolSegmentExt  = ".seg"
+	spoolPosition    = "position"
+	spoolBatchSize   = 64 << 10
+	spoolPositionLen = 16
+)
+
+type spoolOptions struct {
+	segmentSize    int64
+	maxSize        int64
+	sync           SpoolSync
+	syncInterval   time.Duration
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// SpoolOption configures [SpoolWriter].
+type SpoolOption func(*spoolOptions)
+
+// WithSpoolSegmentSize sets the size in bytes after which a new segment file is started.
+// Default value is 8MiB.
+func WithSpoolSegmentSize(size int64) SpoolOption {
+	return func(o *spoolOptions) {
+		o.segmentSize = size
+	}
+}
+
+// WithSpoolMaxSize sets the maximum size in bytes of all segment files. When the size would be
+// exceeded, the writes fail with [ErrSpoolFull]. Default value is 1GiB.
+func WithSpoolMaxSize(size int64) SpoolOption {
+	return func(o *spoolOptions) {
+		o.maxSize = size
+	}
+}
+
+// WithSpoolSync sets the fsync policy and the interval used by [SpoolSyncInterval].
+// Default values are [SpoolSyncInterval] and 1s.
+func WithSpoolSync(policy SpoolSync, interval time.Duration) SpoolOption {
+	return func(o *spoolOptions) {
+		o.sync = policy
+		o.syncInterval = interval
+	}
+}
+
+// WithSpoolBackoff sets the bounds of the exponential backoff between delivery attempts.
+// Default values are 100ms and 30s.
+func WithSpoolBackoff(initialBackoff, maxBackoff time.Duration) SpoolOption {
+	return func(o *spoolOptions) {
+		o.initialBackoff = max(initialBackoff, time.Millisecond)
+		o.maxBackoff = max(maxBackoff, o.initialBackoff)
+	}
+}
+
+type spoolSegment struct {
+	seq  uint64
+	size int64
+}
+
+// SpoolWriter is an [io.Writer] which persists lines produced by [Handler] to segment files in
+// a spool directory and replays them in order to the wrapped writer, so the records survive outages
+// of the destination and restarts of the application.
+//
+// A line is removed from the spool only after the wrapped writer accepted it without error.
+// When the wrapped writer has Flush(context.Context) error method, as the network writers of this
+// package do, the line is removed only after a successful flush. Failed deliveries are retried with
+// jittered exponential backoff, except for the lines rejected with [RejectedError], which are removed
+// as well. The delivery is at-least-once, so the lines may be repeated after a failure or restart.
+//
+// [ElasticsearchWriter] and [OTLPWriter] wrapped by the spool stop flushing in the background
+// and keep the records they could not deliver instead of dead-lettering or dropping them, so all
+// failures are handled by the spool. Such writers should not be written to by anything else.
+//
+// The segments are checked when the spool is opened and a partially written line, left by a crash,
+// is truncated.
+type SpoolWriter struct {
+	dir     string
+	out     io.Writer
+	options spoolOptions
+
+	mu       sync.Mutex
+	segments []spoolSegment
+	file     *os.File
+	total    int64
+	empty    chan struct{}
+	closed   bool
+
+	dropped atomic.Uint64
+
+	// readOffset is the delivered part of the first segment, it is updated
+	// by the background goroutine under s.mu
+	readOffset int64
+	position   *os.File
+
+	// used only by the background goroutine
+	readFile *os.File
+	buffer   []byte
+	// unflushed is the size of the batch retained by the wrapped writer after a failed flush
+	unflushed int
+
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// spoolFlusher is implemented by the writers which buffer the data
+type spoolFlusher interface {
+	Flush(ctx context.Context) error
+}
+
+// spoolDriven is implemented by the writers which flush in the background and handle the failures
+// themselves. The spool switches them to flushing only by its Flush calls, so no record is lost
+// by a background flush the spool does not know about.
+type spoolDriven interface {
+	setSpoolDriven()
+}
+
+// NewSpoolWriter opens the spool in given directory, creating it if needed, and starts
+// the replay of spooled lines to w. The writer should be closed by [SpoolWriter.Close].
+func NewSpoolWriter(dir string, w io.Writer, options ...SpoolOption) (*SpoolWriter, error) {
+	opts := spoolOptions{
+		segmentSize:    8 << 20,
+		maxSize:        1 << 30,
+		sync:           SpoolSyncInterval,
+		syncInterval:   time.Second,
+		initialBackoff: 100 * time.Millisecond,
+		maxBackoff:     30 * time.Second,
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	s := &SpoolWriter{
+		dir:     dir,
+		out:     w,
+		options: opts,
+		empty:   make(chan struct{}),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	if driven, ok := w.(spoolDriven); ok {
+		driven.setSpoolDriven()
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	if opts.sync == SpoolSyncInterval && opts.syncInterval > 0 {
+		s.wg.Add(1)
+		go s.syncLoop()
+	}
+	return s, nil
+}
+
+// Write appends p to the spool. p should contain whole lines.
+func (s *SpoolWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, ErrClosed
+	}
+	if s.total+int64(len(p)) > s.options.maxSize {
+		s.dropped.Add(uint64(max(bytes.Count(p, []byte{'\n'}), 1)))
+		return 0, ErrSpoolFull
+	}
+
+	current := &s.segments[len(s.segments)-1]
+	if current.size > 0 && current.size+int64(len(p)) > s.options.segmentSize {
+		if err := s.rotate(); err != nil {
+			return 0, err
+		}
+		current = &s.segments[len(s.segments)-1]
+	}
+
+	n, err := s.file.Write(p)
+	if err != nil {
+		// do not leave a partial line in the segment
+		if n > 0 {
+			_ = s.file.Truncate(current.size)
+		}
+		return 0, err
+	}
+	current.size += int64(n)
+	s.total += int64(n)
+
+	if s.options.sync == SpoolSyncAlways {
+		if err := s.file.Sync(); err != nil {
+			return n, err
+		}
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return n, nil
+}
+
+// Dropped returns the number of lines dropped due to the full spool.
+func (s *SpoolWriter) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Flush waits until all spooled lines are delivered.
+func (s *SpoolWriter) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	if s.total-s.readOffset == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	empty := s.empty
+	s.mu.Unlock()
+
+	select {
+	case <-empty:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close waits until all spooled lines are delivered or ctx is done and closes the spool.
+// Lines which were not delivered are replayed when the spool is opened again.
+// The wrapped writer is not closed.
+func (s *SpoolWriter) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	err := s.Flush(ctx)
+
+	close(s.stop)
+	s.wg.Wait()
+
+	if s.options.sync != SpoolSyncNever {
+		err = errors.Join(err, s.file.Sync(), s.position.Sync())
+	}
+	err = errors.Join(err, s.file.Close(), s.position.Close())
+	if s.readFile != nil {
+		err = errors.Join(err, s.readFile.Close())
+	}
+	return err
+}
+
+func (s *SpoolWriter) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016x%s", seq, spoolSegmentExt))
+}
+
+// open recovers the state of the spool from the directory
+func (s *SpoolWriter) open() error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), spoolSegmentExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		var seq uint64
+		if _, err := fmt.Sscanf(name, "%016x", &seq); err != nil {
+			continue
+		}
+		s.segments = append(s.segments, spoolSegment{seq: seq})
+	}
+	slices.SortFunc(s.segments, func(a, b spoolSegment) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+
+	s.position, err = os.OpenFile(filepath.Join(s.dir, spoolPosition), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	var position [spoolPositionLen]byte
+	readSeq, readOffset := uint64(0), int64(0)
+	if _, err := s.position.ReadAt(position[:], 0); err == nil {
+		readSeq = binary.LittleEndian.Uint64(position[:8])
+		readOffset = int64(binary.LittleEndian.Uint64(position[8:]))
+	}
+
+	// remove the segments delivered before the last restart
+	for len(s.segments) > 0 && s.segments[0].seq < readSeq {
+		if err := os.Remove(s.segmentPath(s.segments[0].seq)); err != nil {
+			return errors.Join(err, s.position.Close())
+		}
+		s.segments = s.segments[1:]
+	}
+	if len(s.segments) == 0 || s.segments[0].seq != readSeq {
+		readOffset = 0
+	}
+
+	for i := range s.segments {
+		size, err := recoverSegment(s.segmentPath(s.segments[i].seq))
+		if err != nil {
+			return errors.Join(err, s.position.Close())
+		}
+		s.segments[i].size = size
+		s.total += size
+	}
+
+	if len(s.segments) == 0 {
+		s.segments = append(s.segments, spoolSegment{seq: readSeq + 1})
+	}
+	s.readOffset = min(readOffset, s.segments[0].size)
+	if err := s.writePosition(); err != nil {
+		return errors.Join(err, s.position.Close())
+	}
+
+	current := s.segments[len(s.segments)-1]
+	s.file, err = os.OpenFile(s.segmentPath(current.seq), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return errors.Join(err, s.position.Close())
+	}
+	return nil
+}
+
+// recoverSegment truncates the partial line at the end of the segment and returns its size
+func recoverSegment(path string) (int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	size := info.Size()
+	block := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := max(end-int64(len(block)), 0)
+		if _, err := f.ReadAt(block[:end-start], start); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(block[:end-start], '\n'); i != -1 {
+			end = start + int64(i) + 1
+			if end < size {
+				return end, f.Truncate(end)
+			}
+			return size, nil
+		}
+		end = start
+	}
+	return 0, f.Truncate(0)
+}
+
+// rotate starts a new segment, it must be called with s.mu held
+func (s *SpoolWriter) rotate() error {
+	seq := s.segments[len(s.segments)-1].seq + 1
+	file, err := os.OpenFile(s.segmentPath(seq), os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	var syncErr error
+	if s.options.sync != SpoolSyncNever {
+		syncErr = s.file.Sync()
+	}
+	if err := errors.Join(syncErr, s.file.Close()); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return err
+	}
+
+	s.file = file
+	s.segments = append(s.segments, spoolSegment{seq: seq})
+	return nil
+}
+
+func (s *SpoolWriter) writePosition() error {
+	var position [spoolPositionLen]byte
+	binary.LittleEndian.PutUint64(position[:8], s.segments[0].seq)
+	binary.LittleEndian.PutUint64(position[8:], uint64(s.readOffset))
+	if _, err := s.position.WriteAt(position[:], 0); err != nil {
+		return err
+	}
+	if s.options.sync == SpoolSyncAlways {
+		return s.position.Sync()
+	}
+	return nil
+}
+
+func (s *SpoolWriter) syncLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.options.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// the segment may be closed by rotation in the meantime, which syncs it
+			s.mu.Lock()
+			file := s.file
+			s.mu.Unlock()
+			_ = file.Sync()
+			_ = s.position.Sync()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *SpoolWriter) run() {
+	defer s.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.stop
+		cancel()
+	}()
+
+	backoff := newBackoff(s.options.initialBackoff, s.options.maxBackoff)
+	for {
+		if err := s.replay(ctx); err == nil {
+			backoff.reset()
+			select {
+			case <-s.wake:
+				continue
+			case <-s.stop:
+				return
+			}
+		}
+
+		if !backoff.wait(s.stop) {
+			return
+		}
+	}
+}
+
+// replay delivers spooled lines until the spool is empty
+func (s *SpoolWriter) replay(ctx context.Context) error {
+	for {
+		// the batch retained by the wrapped writer is only flushed again
+		n := s.unflushed
+		if n == 0 {
+			batch, err := s.read()
+			if err != nil || len(batch) == 0 {
+				return err
+			}
+			if _, err := s.out.Write(batch); err != nil {
+				return err
+			}
+			n = len(batch)
+		}
+
+		s.unflushed = 0
+		if flusher, ok := s.out.(spoolFlusher); ok {
+			err := flusher.Flush(ctx)
+			if errors.As(err, new(retainedError)) {
+				s.unflushed = n
+				return err
+			}
+			// the rejected lines would be rejected again
+			if err != nil && !errors.As(err, new(*RejectedError)) {
+				return err
+			}
+		}
+
+		s.mu.Lock()
+		s.readOffset += int64(n)
+		err := s.writePosition()
+		s.notifyEmpty()
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// read returns the next batch of whole lines, removing the delivered segments
+func (s *SpoolWriter) read() ([]byte, error) {
+	size := spoolBatchSize
+	for {
+		s.mu.Lock()
+		head := s.segments[0]
+		last := len(s.segments) == 1
+		s.mu.Unlock()
+
+		if s.readOffset >= head.size {
+			if last {
+				return nil, nil
+			}
+			if err := s.removeHead(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if s.readFile == nil {
+			var err error
+			if s.readFile, err = os.Open(s.segmentPath(head.seq)); err != nil {
+				return nil, err
+			}
+		}
+
+		n := min(int64(size), head.size-s.readOffset)
+		s.buffer = slices.Grow(s.buffer[:0], int(n))[:n]
+		if _, err := s.readFile.ReadAt(s.buffer, s.readOffset); err != nil {
+			return nil, err
+		}
+
+		if end := bytes.LastIndexByte(s.buffer, '\n'); end != -1 {
+			return s.buffer[:end+1], nil
+		}
+		if s.readOffset+n == head.size {
+			// the rest of the line has not been written yet
+			return nil, nil
+		}
+		size *= 2
+	}
+}
+
+// removeHead removes the delivered segment
+func (s *SpoolWriter) removeHead() error {
+	if s.readFile != nil {
+		if err := s.readFile.Close(); err != nil {
+			return err
+		}
+		s.readFile = nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	head := s.segments[0]
+	s.segments = s.segments[1:]
+	s.total -= head.size
+	s.readOffset = 0
+	if err := s.writePosition(); err != nil {
+		return err
+	}
+	return os.Remove(s.segmentPath(head.seq))
+}
+
+// notifyEmpty wakes the waiting flushes, it must be called with s.mu held
+func (s *SpoolWriter) notifyEmpty() {
+	if s.total-s.readOffset == 0 {
+		close(s.empty)
+		s.empty = make(chan struct{})
+	}
+}
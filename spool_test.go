@@ -0,0 +1,176 @@
+package ecslog
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyWriter buffers the writes and delivers them on flush, unless it is failing
+type flakyWriter struct {
+	mu        sync.Mutex
+	failing   bool
+	pending   []byte
+	delivered syncBuffer
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = append(w.pending, p...)
+	return len(p), nil
+}
+
+func (w *flakyWriter) Flush(_ context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	defer func() { w.pending = nil }()
+	if w.failing {
+		return errors.New("destination is down")
+	}
+	_, err := w.delivered.Write(w.pending)
+	return err
+}
+
+func (w *flakyWriter) setFailing(failing bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.failing = failing
+}
+
+func writeSpoolLines(t *testing.T, s *SpoolWriter, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if _, err := s.Write([]byte(line + "\n")); err != nil {
+			t.Fatalf("write failed: %s", err)
+		}
+	}
+}
+
+func TestSpoolWriter_Replay(t *testing.T) {
+	dir := t.TempDir()
+	out := &flakyWriter{failing: true}
+	s, err := NewSpoolWriter(dir, out,
+		WithSpoolBackoff(time.Millisecond, 5*time.Millisecond),
+		WithSpoolSegmentSize(10),
+		WithSpoolSync(SpoolSyncAlways, 0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeSpoolLines(t, s, "first", "second", "third")
+	time.Sleep(20 * time.Millisecond)
+	if out.delivered.String() != "" {
+		t.Fatalf("unexpected delivery: %q", out.delivered.String())
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if len(segments) != 3 {
+		t.Errorf("expected 3 segments, got %v", segments)
+	}
+
+	out.setFailing(false)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	writeSpoolLines(t, s, "fourth")
+	if err := s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"first", "second", "third", "fourth"}
+	if lines := out.delivered.lines(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("mismatched lines\nEXP: %v\nGOT: %v", expected, lines)
+	}
+
+	segments, _ = filepath.Glob(filepath.Join(dir, "*.seg"))
+	if len(segments) != 1 {
+		t.Errorf("expected delivered segments to be removed, got %v", segments)
+	}
+}
+
+func TestSpoolWriter_Recovery(t *testing.T) {
+	dir := t.TempDir()
+	out := &flakyWriter{failing: true}
+	s, err := NewSpoolWriter(dir, out, WithSpoolBackoff(time.Millisecond, 5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSpoolLines(t, s, "first", "second")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// simulate crash in the middle of a write
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	f, err := os.OpenFile(segments[len(segments)-1], os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"message":"thi`)
+	_ = f.Close()
+
+	out.setFailing(false)
+	s, err = NewSpoolWriter(dir, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSpoolLines(t, s, "third")
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"first", "second", "third"}
+	if lines := out.delivered.lines(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("mismatched lines\nEXP: %v\nGOT: %v", expected, lines)
+	}
+
+	// delivered lines are not replayed again
+	s, err = NewSpoolWriter(dir, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if lines := out.delivered.lines(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("mismatched lines after reopen\nEXP: %v\nGOT: %v", expected, lines)
+	}
+}
+
+func TestSpoolWriter_MaxSize(t *testing.T) {
+	out := &flakyWriter{failing: true}
+	s, err := NewSpoolWriter(t.TempDir(), out, WithSpoolMaxSize(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		// the spooled lines are never delivered
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_ = s.Close(ctx)
+	}()
+
+	writeSpoolLines(t, s, "first", "second")
+	if _, err := s.Write([]byte("third\n")); !errors.Is(err, ErrSpoolFull) {
+		t.Errorf("expected full spool, got %v", err)
+	}
+	if s.Dropped() != 1 {
+		t.Errorf("expected 1 dropped line, got %d", s.Dropped())
+	}
+}
@@ -0,0 +1,351 @@
+package ecslog
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/tls"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SyslogFormat selects the header format of syslog messages.
+type SyslogFormat int
+
+const (
+	// SyslogRFC5424 formats messages according to RFC 5424.
+	SyslogRFC5424 SyslogFormat = iota
+	// SyslogRFC3164 formats messages according to RFC 3164 (BSD syslog).
+	SyslogRFC3164
+)
+
+// SyslogFraming selects how messages are delimited on stream transports (TCP, TLS, unix).
+// Datagram transports always send single message per datagram.
+type SyslogFraming int
+
+const (
+	// SyslogOctetCounting prefixes each message with its length (RFC 6587).
+	SyslogOctetCounting SyslogFraming = iota
+	// SyslogNewline terminates each message with newline.
+	SyslogNewline
+)
+
+const syslogRFC5424Time = "2006-01-02T15:04:05.999999Z07:00"
+
+type syslogOptions struct {
+	format    SyslogFormat
+	framing   SyslogFraming
+	facility  int
+	hostname  string
+	appName   string
+	procID    string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+}
+
+// SyslogOption configures [SyslogWriter].
+type SyslogOption func(*syslogOptions)
+
+// WithSyslogFormat sets the format of syslog messages. Default value is [SyslogRFC5424].
+func WithSyslogFormat(format SyslogFormat) SyslogOption {
+	return func(o *syslogOptions) {
+		o.format = format
+	}
+}
+
+// WithSyslogFraming sets the framing used on stream transports. Default value is [SyslogOctetCounting].
+func WithSyslogFraming(framing SyslogFraming) SyslogOption {
+	return func(o *syslogOptions) {
+		o.framing = framing
+	}
+}
+
+// WithSyslogFacility sets the facility code (e.g. 1 for user, 16 for local0).
+// Default value is 1.
+func WithSyslogFacility(facility int) SyslogOption {
+	return func(o *syslogOptions) {
+		o.facility = facility
+	}
+}
+
+// WithSyslogHostname sets the hostname used when the record does not contain "host.hostname".
+// Default value is [os.Hostname].
+func WithSyslogHostname(hostname string) SyslogOption {
+	return func(o *syslogOptions) {
+		o.hostname = hostname
+	}
+}
+
+// WithSyslogAppName sets the app-name used when the record does not contain "service.name".
+// Default value is the name of the executable.
+func WithSyslogAppName(appName string) SyslogOption {
+	return func(o *syslogOptions) {
+		o.appName = appName
+	}
+}
+
+// WithSyslogProcID sets the procid used when the record does not contain "process.pid".
+// Default value is PID of the process.
+func WithSyslogProcID(procID string) SyslogOption {
+	return func(o *syslogOptions) {
+		o.procID = procID
+	}
+}
+
+// WithSyslogTLSConfig sets the configuration used with "tls" network.
+func WithSyslogTLSConfig(config *tls.Config) SyslogOption {
+	return func(o *syslogOptions) {
+		o.tlsConfig = config
+	}
+}
+
+// WithSyslogTimeout sets the timeout of dialing and writing to the connection.
+// Default value is 5s.
+func WithSyslogTimeout(timeout time.Duration) SyslogOption {
+	return func(o *syslogOptions) {
+		o.timeout = timeout
+	}
+}
+
+// SyslogWriter is an [io.Writer] which sends each line produced by [Handler] as a syslog message.
+//
+// The JSON line is used as the message content unchanged. The header is derived from the record:
+// the severity from "log.level", hostname from "host.hostname", app-name from "service.name"
+// and procid from "process.pid". Missing values are taken from options.
+//
+// Supported networks are "udp", "tcp", "tls", "unix" and "unixgram" (e.g. "/dev/log").
+// When writing fails, the connection is re-established and the message is sent once more.
+type SyslogWriter struct {
+	network string
+	addr    string
+	options syslogOptions
+
+	mu     sync.Mutex
+	conn   net.Conn
+	buffer []byte
+}
+
+// syslogRecord holds fields of the record used in the syslog header
+type syslogRecord struct {
+	Timestamp string `json:"@timestamp"`
+	Log       struct {
+		Level string `json:"level"`
+	} `json:"log"`
+	Host struct {
+		Hostname string `json:"hostname"`
+	} `json:"host"`
+	Service struct {
+		Name string `json:"name"`
+	} `json:"service"`
+	Process struct {
+		Pid json.Number `json:"pid"`
+	} `json:"process"`
+}
+
+// NewSyslogWriter creates a new [SyslogWriter] and connects to given address.
+func NewSyslogWriter(network, addr string, options ...SyslogOption) (*SyslogWriter, error) {
+	opts := syslogOptions{
+		facility: 1,
+		procID:   strconv.Itoa(os.Getpid()),
+		appName:  filepath.Base(os.Args[0]),
+		timeout:  5 * time.Second,
+	}
+	opts.hostname, _ = os.Hostname()
+	for _, option := range options {
+		option(&opts)
+	}
+
+	w := &SyslogWriter{
+		network: network,
+		addr:    addr,
+		options: opts,
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write sends each line of p as a separate syslog message.
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for line := range bytes.Lines(p) {
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if len(line) == 0 {
+			continue
+		}
+
+		w.buffer = w.appendMessage(w.buffer[:0], line)
+		if err := w.send(w.buffer); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close closes the connection.
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *SyslogWriter) isStream() bool {
+	return w.network != "udp" && w.network != "udp4" && w.network != "udp6" && w.network != "unixgram"
+}
+
+func (w *SyslogWriter) connect() error {
+	dialer := net.Dialer{Timeout: w.options.timeout}
+
+	var err error
+	if w.network == "tls" {
+		w.conn, err = tls.DialWithDialer(&dialer, "tcp", w.addr, w.options.tlsConfig)
+	} else {
+		w.conn, err = dialer.Dial(w.network, w.addr)
+	}
+	return err
+}
+
+// send must be called with w.mu held
+func (w *SyslogWriter) send(msg []byte) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				continue
+			}
+		}
+
+		if w.options.timeout > 0 {
+			_ = w.conn.SetWriteDeadline(time.Now().Add(w.options.timeout))
+		}
+		if _, err = w.conn.Write(msg); err == nil {
+			return nil
+		}
+
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+func (w *SyslogWriter) appendMessage(output []byte, line []byte) []byte {
+	var record syslogRecord
+	// invalid records are still sent, only with the default header
+	_ = json.Unmarshal(line, &record)
+
+	t0, err := time.Parse(time.RFC3339Nano, record.Timestamp)
+	if err != nil {
+		t0 = time.Now()
+	}
+	hostname := cmp.Or(record.Host.Hostname, w.options.hostname)
+	appName := cmp.Or(record.Service.Name, w.options.appName)
+	procID := cmp.Or(record.Process.Pid.String(), w.options.procID)
+	pri := w.options.facility*8 + syslogSeverity(parseLevel(record.Log.Level))
+
+	if w.isStream() && w.options.framing == SyslogOctetCounting {
+		// the length is not known yet, so it is inserted when the message is complete
+		start := len(output)
+		output = w.appendHeader(output, pri, t0, hostname, appName, procID)
+		output = append(output, line...)
+
+		length := strconv.Itoa(len(output)-start) + " "
+		output = append(output, length...)
+		copy(output[start+len(length):], output[start:len(output)-len(length)])
+		copy(output[start:], length)
+		return output
+	}
+
+	output = w.appendHeader(output, pri, t0, hostname, appName, procID)
+	output = append(output, line...)
+	if w.isStream() {
+		output = append(output, '\n')
+	}
+	return output
+}
+
+func (w *SyslogWriter) appendHeader(output []byte, pri int, t0 time.Time, hostname, appName, procID string) []byte {
+	output = append(output, '<')
+	output = strconv.AppendInt(output, int64(pri), 10)
+	output = append(output, '>')
+
+	if w.options.format == SyslogRFC3164 {
+		output = t0.AppendFormat(output, time.Stamp)
+		output = append(output, ' ')
+		output = appendSyslogToken(output, hostname, 255)
+		output = append(output, ' ')
+		output = appendSyslogToken(output, appName, 32)
+		output = append(output, '[')
+		output = appendSyslogToken(output, procID, 128)
+		output = append(output, "]: "...)
+		return output
+	}
+
+	output = append(output, "1 "...)
+	output = t0.AppendFormat(output, syslogRFC5424Time)
+	output = append(output, ' ')
+	output = appendSyslogToken(output, hostname, 255)
+	output = append(output, ' ')
+	output = appendSyslogToken(output, appName, 48)
+	output = append(output, ' ')
+	output = appendSyslogToken(output, procID, 128)
+	// MSGID and STRUCTURED-DATA are not used, all data are in the JSON message
+	output = append(output, " - - "...)
+	return output
+}
+
+// appendSyslogToken appends header field, which must consist of printable ASCII characters
+func appendSyslogToken(output []byte, value string, maxLen int) []byte {
+	if value == "" {
+		return append(output, '-')
+	}
+
+	for i := 0; i < len(value) && i < maxLen; i++ {
+		if value[i] <= ' ' || value[i] > '~' {
+			output = append(output, '_')
+			continue
+		}
+		output = append(output, value[i])
+	}
+	return output
+}
+
+// syslogSeverity maps slog.Level to syslog severity
+func syslogSeverity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError+4:
+		return 2 // critical
+	case level >= slog.LevelError:
+		return 3 // error
+	case level >= slog.LevelWarn:
+		return 4 // warning
+	case level > slog.LevelInfo:
+		return 5 // notice
+	case level >= slog.LevelInfo:
+		return 6 // informational
+	default:
+		return 7 // debug
+	}
+}
+
+// parseLevel parses "log.level" value produced by Handler, unknown values are considered slog.LevelInfo
+func parseLevel(value string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
@@ -0,0 +1,195 @@
+package ecslog
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogWriter_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	w, err := NewSyslogWriter("udp", conn.LocalAddr().String(),
+		WithSyslogFacility(16),
+		WithSyslogHostname("default-host"),
+		WithSyslogAppName("default-app"),
+		WithSyslogProcID("42"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = w.Close() }()
+
+	ecs := slog.New(NewHandler(w))
+	ecs.Error("Hello World", slog.String("host.hostname", "ecs host"))
+
+	buff := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buff[:n])
+
+	// <16*8+3>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+	fields := strings.SplitN(msg, " ", 8)
+	if len(fields) != 8 {
+		t.Fatalf("invalid message: %s", msg)
+	}
+	if fields[0] != "<131>1" || fields[2] != "ecs_host" || fields[3] != "default-app" ||
+		fields[4] != "42" || fields[5] != "-" || fields[6] != "-" {
+		t.Errorf("invalid header: %s", msg)
+	}
+	output := unmarshalLogs(t, strings.NewReader(fields[7]))
+	if output[0]["message"] != "Hello World" {
+		t.Errorf("invalid message content: %s", fields[7])
+	}
+}
+
+func TestSyslogWriter_TCPOctetCounting(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	w, err := NewSyslogWriter("tcp", listener.Addr().String(), WithSyslogProcID("42"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = w.Close() }()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	ecs := slog.New(NewHandler(w, WithLogLevel(slog.LevelDebug)))
+	ecs.Debug("first\nline", slog.Int("process.pid", 7))
+	ecs.Warn("second")
+
+	r := bufio.NewReader(conn)
+	for _, expected := range []struct {
+		pri, procID, msg string
+	}{
+		{pri: "<15>1", procID: "7", msg: "first\nline"},
+		{pri: "<12>1", procID: "42", msg: "second"},
+	} {
+		length, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			t.Fatalf("invalid octet count %q", length)
+		}
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			t.Fatal(err)
+		}
+
+		fields := strings.SplitN(string(frame), " ", 8)
+		if fields[0] != expected.pri || fields[4] != expected.procID {
+			t.Errorf("invalid header: %s", frame)
+		}
+		output := unmarshalLogs(t, strings.NewReader(fields[7]))
+		if output[0]["message"] != expected.msg {
+			t.Errorf("invalid message content: %s", fields[7])
+		}
+	}
+}
+
+func TestSyslogWriter_Reconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	w, err := NewSyslogWriter("tcp", listener.Addr().String(), WithSyslogFraming(SyslogNewline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = w.Close() }()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	received := make(chan string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	// writes to the closed connection may succeed until the peer reset is noticed
+	ecs := slog.New(NewHandler(w))
+	for i := 0; i < 100; i++ {
+		ecs.Info("Hello World")
+		select {
+		case line := <-received:
+			if !strings.HasPrefix(line, "<14>1 ") || !strings.HasSuffix(line, "}\n") {
+				t.Errorf("invalid message: %q", line)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Error("writer did not reconnect")
+}
+
+func TestSyslogWriter_UnixgramRFC3164(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skipf("unixgram not supported: %s", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	w, err := NewSyslogWriter("unixgram", path,
+		WithSyslogFormat(SyslogRFC3164),
+		WithSyslogHostname("host"),
+		WithSyslogAppName("app"),
+		WithSyslogProcID("42"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = w.Close() }()
+
+	ecs := slog.New(NewHandler(w, WithTimestamp(false)))
+	ecs.Info("Hello World")
+
+	buff := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buff[:n])
+
+	// <14>Mmm dd hh:mm:ss host app[42]: MSG
+	prefix, content, ok := strings.Cut(msg, " host app[42]: ")
+	if !ok || !strings.HasPrefix(prefix, "<14>") || len(prefix) != len("<14>Jan _2 15:04:05") {
+		t.Fatalf("invalid message: %s", msg)
+	}
+	if content != `{"message":"Hello World","log":{"level":"INFO"}}` {
+		t.Errorf("invalid message content: %s", content)
+	}
+}
@@ -0,0 +1,28 @@
+package ecslog
+
+import (
+	"context"
+	"log/slog"
+)
+
+// attrsHandler is implemented by [Handler] and by the handler wrappers of this package.
+// It allows the wrappers to add top-level attributes (e.g. "log.sampled") to the record,
+// which are not affected by groups.
+type attrsHandler interface {
+	handleWithAttrs(ctx context.Context, record slog.Record, attrs []slog.Attr) error
+}
+
+// handleWithAttrs passes the record with additional top-level attributes to h.
+// Handlers outside of this package receive the attributes as a part of the record.
+func handleWithAttrs(ctx context.Context, h slog.Handler, record slog.Record, attrs []slog.Attr) error {
+	if len(attrs) == 0 {
+		return h.Handle(ctx, record)
+	}
+	if ah, ok := h.(attrsHandler); ok {
+		return ah.handleWithAttrs(ctx, record, attrs)
+	}
+
+	record = record.Clone()
+	record.AddAttrs(attrs...)
+	return h.Handle(ctx, record)
+}